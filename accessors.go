@@ -0,0 +1,177 @@
+package vitotrol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Errors returned by the typed accessors of Device, as Float or
+// Time, that can be matched using errors.Is.
+var (
+	// ErrUnknownAttribute is returned when the attribute is not in the
+	// registry of the device.
+	ErrUnknownAttribute = errors.New("Unknown attribute")
+	// ErrUninitialized is returned when the attribute value has not
+	// been read yet, see Device.GetData.
+	ErrUninitialized = errors.New("Uninitialized attribute")
+	// ErrWrongType is returned when the type of the attribute does not
+	// match the accessor, as Time for a Double attribute.
+	ErrWrongType = errors.New("Wrong attribute type")
+)
+
+// ValueError is returned by the typed accessors of Device when the
+// cached value of an attribute cannot be converted by its
+// VitodataType.
+type ValueError struct {
+	AttrID AttrID
+	Name   string // name of the attribute
+	Value  string // raw Vitodata™ value
+	Err    error  // conversion error
+}
+
+// Error returns the error as a string.
+func (e *ValueError) Error() string {
+	return fmt.Sprintf("Invalid value `%s' of %s: %s", e.Value, e.Name, e.Err)
+}
+
+// Unwrap returns the conversion error.
+func (e *ValueError) Unwrap() error {
+	return e.Err
+}
+
+// native returns the native value of attribute attrID, as converted
+// by its VitodataType, its reference and its timestamp.
+func (d *Device) native(attrID AttrID) (interface{}, *AttrRef, Time, error) {
+	pRef := d.Registry().Ref(attrID)
+	if pRef == nil {
+		return nil, nil, Time{}, fmt.Errorf("%w %d", ErrUnknownAttribute, attrID)
+	}
+
+	value, ok := d.Attribute(attrID)
+	if !ok {
+		return nil, pRef, Time{}, fmt.Errorf("%w %s", ErrUninitialized, pRef.Name)
+	}
+
+	native, err := pRef.Type.Vitodata2NativeValue(value.Value)
+	if err != nil {
+		return nil, pRef, value.Time, &ValueError{
+			AttrID: attrID,
+			Name:   pRef.Name,
+			Value:  value.Value,
+			Err:    err,
+		}
+	}
+	return native, pRef, value.Time, nil
+}
+
+func wrongType(pRef *AttrRef) error {
+	return fmt.Errorf("%w: %s is %s", ErrWrongType, pRef.Name, pRef.Type.Type())
+}
+
+// Float returns the last read value of the numeric attribute attrID
+// and its timestamp.
+func (d *Device) Float(attrID AttrID) (float64, Time, error) {
+	native, pRef, tm, err := d.native(attrID)
+	if err != nil {
+		return 0, tm, err
+	}
+
+	switch native := native.(type) {
+	case float64:
+		return native, tm, nil
+	case int64:
+		return float64(native), tm, nil
+	}
+	return 0, tm, wrongType(pRef)
+}
+
+// FloatIn is the same as Float, but the value is converted from the
+// unit of the attribute to unit, as UnitFahrenheit for a °C
+// attribute. See ConvertUnit.
+func (d *Device) FloatIn(attrID AttrID, unit Unit) (float64, Time, error) {
+	native, pRef, tm, err := d.native(attrID)
+	if err != nil {
+		return 0, tm, err
+	}
+
+	var f float64
+	switch native := native.(type) {
+	case float64:
+		f = native
+	case int64:
+		f = float64(native)
+	default:
+		return 0, tm, wrongType(pRef)
+	}
+
+	f, err = ConvertUnit(f, pRef.Unit, unit)
+	return f, tm, err
+}
+
+// Int returns the last read value of the integer attribute attrID
+// and its timestamp. Double attributes are accepted as long as their
+// value is integral, enum ones return the index of their value.
+func (d *Device) Int(attrID AttrID) (int64, Time, error) {
+	native, pRef, tm, err := d.native(attrID)
+	if err != nil {
+		return 0, tm, err
+	}
+
+	switch native := native.(type) {
+	case int64:
+		return native, tm, nil
+	case uint64:
+		return int64(native), tm, nil
+	case float64:
+		if native == math.Trunc(native) {
+			return int64(native), tm, nil
+		}
+	}
+	return 0, tm, wrongType(pRef)
+}
+
+// Bool returns the last read value of the two-value enum attribute
+// attrID, as PartyMode, and its timestamp. The first value of the
+// enum (as "disabled" or "off") is false, the second one is true.
+func (d *Device) Bool(attrID AttrID) (bool, Time, error) {
+	native, pRef, tm, err := d.native(attrID)
+	if err != nil {
+		return false, tm, err
+	}
+
+	if enum, ok := pRef.Type.(*VitodataEnum); ok && len(enum.revValues) == 2 {
+		return native.(uint64) == 1, tm, nil
+	}
+	return false, tm, wrongType(pRef)
+}
+
+// EnumValue returns the last read value of the enum attribute attrID
+// as a human string, as "continuous normal" for
+// OperatingModeRequested, and its timestamp. See Int to get its
+// index instead.
+func (d *Device) EnumValue(attrID AttrID) (string, Time, error) {
+	native, pRef, tm, err := d.native(attrID)
+	if err != nil {
+		return "", tm, err
+	}
+
+	if enum, ok := pRef.Type.(*VitodataEnum); ok {
+		return enum.revValues[native.(uint64)], tm, nil
+	}
+	return "", tm, wrongType(pRef)
+}
+
+// Time returns the last read value of the date attribute attrID, as
+// HolidaysStart, and its timestamp.
+func (d *Device) Time(attrID AttrID) (Time, Time, error) {
+	native, pRef, tm, err := d.native(attrID)
+	if err != nil {
+		return Time{}, tm, err
+	}
+
+	if value, ok := native.(Time); ok {
+		return value, tm, nil
+	}
+	return Time{}, tm, wrongType(pRef)
+}
@@ -0,0 +1,137 @@
+package vitotrol
+
+import (
+	"testing"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+func TestDeviceAccessors(tt *testing.T) {
+	t := td.NewT(tt)
+
+	holidays, err := ParseVitotrolTime("2024-07-14 00:00:00")
+	t.Require().CmpNoError(err)
+
+	d := &Device{
+		Attributes: map[AttrID]*Value{
+			BoilerTemp:             {Value: "54,3", Time: testTime},
+			BurnerStarts:           {Value: "1234", Time: testTime},
+			SmokeTemp:              {Value: "123,5", Time: testTime},
+			IndoorTemp:             {Value: "abc", Time: testTime},
+			PartyMode:              {Value: "1", Time: testTime},
+			BurnerState:            {Value: "0", Time: testTime},
+			OperatingModeRequested: {Value: "2", Time: testTime},
+			HolidaysStart:          {Value: holidays.String(), Time: testTime},
+			9876:                   {Value: "42", Time: testTime},
+		},
+	}
+	d.Registry().Add(9876, AttrRef{Type: TypeInteger, Name: "Foo"})
+
+	// Float
+	f, tm, err := d.Float(BoilerTemp)
+	t.CmpNoError(err)
+	t.Cmp(f, 54.3)
+	t.Cmp(tm, testTime)
+
+	f, _, err = d.Float(9876)
+	t.CmpNoError(err)
+	t.Cmp(f, 42.0)
+
+	_, _, err = d.Float(PartyMode)
+	t.CmpErrorIs(err, ErrWrongType)
+	t.String(err, "Wrong attribute type: PartyMode is Enum2")
+
+	// FloatIn
+	f, tm, err = d.FloatIn(BoilerTemp, UnitKelvin)
+	t.CmpNoError(err)
+	t.Cmp(f, td.Between(327.45-1e-9, 327.45+1e-9))
+	t.Cmp(tm, testTime)
+
+	f, _, err = d.FloatIn(BoilerTemp, UnitCelsius)
+	t.CmpNoError(err)
+	t.Cmp(f, 54.3)
+
+	_, _, err = d.FloatIn(BurnerStarts, UnitCelsius)
+	t.CmpErrorIs(err, ErrIncompatibleUnits)
+
+	_, _, err = d.FloatIn(PartyMode, UnitCelsius)
+	t.CmpErrorIs(err, ErrWrongType)
+
+	// Int
+	n, tm, err := d.Int(BurnerStarts)
+	t.CmpNoError(err)
+	t.Cmp(n, int64(1234))
+	t.Cmp(tm, testTime)
+
+	n, _, err = d.Int(9876)
+	t.CmpNoError(err)
+	t.Cmp(n, int64(42))
+
+	n, _, err = d.Int(OperatingModeRequested)
+	t.CmpNoError(err)
+	t.Cmp(n, int64(2))
+
+	_, _, err = d.Int(SmokeTemp)
+	t.CmpErrorIs(err, ErrWrongType)
+
+	// Bool
+	b, tm, err := d.Bool(PartyMode)
+	t.CmpNoError(err)
+	t.True(b)
+	t.Cmp(tm, testTime)
+
+	b, _, err = d.Bool(BurnerState)
+	t.CmpNoError(err)
+	t.False(b)
+
+	_, _, err = d.Bool(OperatingModeRequested)
+	t.CmpErrorIs(err, ErrWrongType)
+
+	// EnumValue
+	s, tm, err := d.EnumValue(OperatingModeRequested)
+	t.CmpNoError(err)
+	t.Cmp(s, "heating+DHW")
+	t.Cmp(tm, testTime)
+
+	s, _, err = d.EnumValue(PartyMode)
+	t.CmpNoError(err)
+	t.Cmp(s, "enabled")
+
+	_, _, err = d.EnumValue(BoilerTemp)
+	t.CmpErrorIs(err, ErrWrongType)
+
+	// Time
+	value, tm, err := d.Time(HolidaysStart)
+	t.CmpNoError(err)
+	t.Cmp(value, holidays)
+	t.Cmp(tm, testTime)
+
+	_, _, err = d.Time(BoilerTemp)
+	t.CmpErrorIs(err, ErrWrongType)
+
+	// Invalid value
+	_, tm, err = d.Float(IndoorTemp)
+	t.Cmp(err, td.Isa(&ValueError{}))
+	t.Cmp(err, td.Struct(&ValueError{
+		AttrID: IndoorTemp,
+		Name:   "IndoorTemp",
+		Value:  "abc",
+	}, td.StructFields{"Err": td.NotNil()}))
+	t.Cmp(tm, testTime)
+	t.Cmp(err.Error(), td.HasPrefix("Invalid value `abc' of IndoorTemp: "))
+
+	d.Attributes[PartyMode].Value = "7"
+	_, _, err = d.Bool(PartyMode)
+	t.CmpErrorIs(err, ErrEnumInvalidValue)
+
+	// Uninitialized
+	_, tm, err = d.Float(OutdoorTemp)
+	t.CmpErrorIs(err, ErrUninitialized)
+	t.String(err, "Uninitialized attribute OutdoorTemp")
+	t.Cmp(tm, Time{})
+
+	// Unknown
+	_, _, err = d.Float(1234)
+	t.CmpErrorIs(err, ErrUnknownAttribute)
+	t.String(err, "Unknown attribute 1234")
+}
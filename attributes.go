@@ -3,6 +3,7 @@ package vitotrol
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 // An AttrID defines an attribute ID.
@@ -67,12 +68,22 @@ type AttrRef struct {
 	Name   string
 	Doc    string
 	Custom bool
+	Range  *AttrRange // allowed values of numeric attributes, if not nil
+	Unit   Unit
 }
 
 // String returns all information contained in this attribute reference.
 func (r *AttrRef) String() string {
-	return fmt.Sprintf("%s: %s (%s - %s)",
-		r.Name, r.Doc, r.Type.Type(), AccessToStr[r.Access])
+	typ := r.Type.Type()
+	if r.Unit != UnitNone {
+		typ += " " + string(r.Unit)
+	}
+	str := fmt.Sprintf("%s: %s (%s - %s)",
+		r.Name, r.Doc, typ, AccessToStr[r.Access])
+	if r.Range != nil {
+		str += " " + r.Range.String()
+	}
+	return str
 }
 
 // AttributesRef lists the reference for each attribute ID.
@@ -82,78 +93,95 @@ var AttributesRef = map[AttrID]*AttrRef{
 		Access: ReadOnly,
 		Doc:    "Indoor temperature",
 		Name:   "IndoorTemp",
+		Unit:   UnitCelsius,
 	},
 	OutdoorTemp: {
 		Type:   TypeDouble,
 		Access: ReadOnly,
 		Doc:    "Outdoor temperature",
 		Name:   "OutdoorTemp",
+		Unit:   UnitCelsius,
 	},
 	SmokeTemp: {
 		Type:   TypeDouble,
 		Access: ReadOnly,
 		Doc:    "Smoke temperature",
 		Name:   "SmokeTemp",
+		Unit:   UnitCelsius,
 	},
 	BoilerTemp: {
 		Type:   TypeDouble,
 		Access: ReadOnly,
 		Doc:    "Boiler temperature",
 		Name:   "BoilerTemp",
+		Unit:   UnitCelsius,
 	},
 	HotWaterTemp: {
 		Type:   TypeDouble,
 		Access: ReadOnly,
 		Doc:    "Hot water temperature",
 		Name:   "HotWaterTemp",
+		Unit:   UnitCelsius,
 	},
 	HotWaterOutTemp: {
 		Type:   TypeDouble,
 		Access: ReadOnly,
 		Doc:    "Hot water outlet temperature",
 		Name:   "HotWaterOutTemp",
+		Unit:   UnitCelsius,
 	},
 	HeatWaterOutTemp: {
 		Type:   TypeDouble,
 		Access: ReadOnly,
 		Doc:    "Heating water outlet temperature",
 		Name:   "HeatWaterOutTemp",
+		Unit:   UnitCelsius,
 	},
 	HeatNormalTemp: {
 		Type:   TypeDouble,
 		Access: ReadWrite,
 		Doc:    "Setpoint of the normal room temperature",
 		Name:   "HeatNormalTemp",
+		Range:  &AttrRange{Min: 3, Max: 37},
+		Unit:   UnitCelsius,
 	},
 	PartyModeTemp: {
 		Type:   TypeDouble,
 		Access: ReadWrite,
 		Doc:    "Party mode temperature",
 		Name:   "PartyModeTemp",
+		Range:  &AttrRange{Min: 3, Max: 37},
+		Unit:   UnitCelsius,
 	},
 	HeatReducedTemp: {
 		Type:   TypeDouble,
 		Access: ReadWrite,
 		Doc:    "Setpoint of the reduced room temperature",
 		Name:   "HeatReducedTemp",
+		Range:  &AttrRange{Min: 3, Max: 37},
+		Unit:   UnitCelsius,
 	},
 	HotWaterSetpointTemp: {
 		Type:   TypeDouble,
 		Access: ReadWrite,
 		Doc:    "Setpoint of the domestic hot water temperature",
 		Name:   "HotWaterSetpointTemp",
+		Range:  &AttrRange{Min: 10, Max: 60},
+		Unit:   UnitCelsius,
 	},
 	BurnerHoursRun: {
 		Type:   TypeDouble,
 		Access: ReadOnly,
 		Doc:    "Burner hours run",
 		Name:   "BurnerHoursRun",
+		Unit:   UnitHours,
 	},
 	BurnerHoursRunReset: {
 		Type:   TypeDouble,
 		Access: WriteOnly,
 		Doc:    "Reset the burner hours run",
 		Name:   "BurnerHoursRunReset",
+		Unit:   UnitHours,
 	},
 	BurnerState: {
 		Type:   TypeOnOffEnum,
@@ -166,6 +194,7 @@ var AttributesRef = map[AttrID]*AttrRef{
 		Access: ReadWrite,
 		Doc:    "Burner starts",
 		Name:   "BurnerStarts",
+		Unit:   UnitStarts,
 	},
 	InternalPumpStatus: {
 		Type: NewEnum([]string{ // 0 -> 3
@@ -276,7 +305,10 @@ var AttributesRef = map[AttrID]*AttrRef{
 
 // AddAttributeRef adds a new attribute to the "official" list. This
 // new attribute will only differ from others by its Custom field set
-// to true.
+// to true. It is only seen by the registries created after the call,
+// so it should be called during the program initialization. Use
+// AttributeRegistry.Add to add an attribute to the registry of a
+// Device.
 //
 // No check is done to avoid overriding existing attributes.
 func AddAttributeRef(attrID AttrID, ref AttrRef) {
@@ -316,9 +348,11 @@ type Value struct {
 	Time  Time
 }
 
-// Num returns the numerical value of this value. If the value is not
-// a numerical one, 0 is returned.
+// Num returns the numerical value of this value, accepting the
+// Vitodata™ comma as decimal separator. If the value is not a
+// numerical one, 0 is returned. See Device.Float for a typed and
+// checked access.
 func (v *Value) Num() (ret float64) {
-	ret, _ = strconv.ParseFloat(v.Value, 64)
+	ret, _ = strconv.ParseFloat(strings.Replace(v.Value, ",", ".", 1), 64)
 	return
 }
@@ -68,6 +68,12 @@ func TestValue(tt *testing.T) {
 	v := Value{Value: "34"}
 	t.CmpDeeply(v.Num(), float64(34))
 
+	v = Value{Value: "54,3"}
+	t.CmpDeeply(v.Num(), 54.3)
+
+	v = Value{Value: "54.3"}
+	t.CmpDeeply(v.Num(), 54.3)
+
 	v = Value{Value: "foo"}
 	t.CmpDeeply(v.Num(), float64(0))
 }
@@ -0,0 +1,170 @@
+package vitotrol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNotWritten is the error of the attributes whose write has not
+// been attempted by Device.WriteMany, due to a previous failure and
+// StopOnError, or because its context is done.
+var ErrNotWritten = errors.New("Not written")
+
+// WriteResult is the outcome of the write of one attribute by
+// Device.WriteMany.
+type WriteResult struct {
+	AttrID AttrID
+	Name   string // name of the attribute in the registry of the device
+	Value  string
+	Err    error // nil if the value has been written
+}
+
+// WriteReport is the outcome of Device.WriteMany, a WriteResult per
+// attribute, sorted by AttrID.
+type WriteReport []WriteResult
+
+// Failed returns the results of the failed writes.
+func (r WriteReport) Failed() WriteReport {
+	var failed WriteReport
+	for _, result := range r {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err returns nil if all the writes succeeded, a *WriteManyError
+// otherwise.
+func (r WriteReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	return &WriteManyError{Failed: failed}
+}
+
+// WriteManyError is returned by Device.WriteMany when at least one
+// write failed. As it unwraps to the errors of the failed writes,
+// errors.Is and errors.As can be used to match any of them.
+type WriteManyError struct {
+	Failed WriteReport
+}
+
+// Error returns the failed writes as a string.
+func (e *WriteManyError) Error() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%d write(s) failed:", len(e.Failed))
+	for idx, result := range e.Failed {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, " %s: %s", result.Name, result.Err)
+	}
+	return buf.String()
+}
+
+// Unwrap returns the errors of the failed writes.
+func (e *WriteManyError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for idx, result := range e.Failed {
+		errs[idx] = result.Err
+	}
+	return errs
+}
+
+type writeManyConfig struct {
+	stopOnError bool
+	options     []OperationOption
+}
+
+// A WriteManyOption configures Device.WriteMany.
+type WriteManyOption func(*writeManyConfig)
+
+// StopOnError makes Device.WriteMany stop at the first failure: the
+// remaining writes are not attempted and fail with ErrNotWritten,
+// the pending ones are no longer polled and fail with
+// context.Canceled, even if they succeed on the Vitotrol™ server.
+func StopOnError() WriteManyOption {
+	return func(c *writeManyConfig) {
+		c.stopOnError = true
+	}
+}
+
+// WithOperationOptions sets the options of each Operation started by
+// Device.WriteMany, as WithWait.
+func WithOperationOptions(options ...OperationOption) WriteManyOption {
+	return func(c *writeManyConfig) {
+		c.options = append(c.options, options...)
+	}
+}
+
+// WriteMany writes all values, issuing the WriteData requests in
+// AttrID order, then polling all the operations concurrently. As
+// all these requests are sent using v, they comply with its rate
+// limiter, if any.
+//
+// The returned report contains the result of each write. The error
+// is the one of report.Err, so nil if all the writes succeeded.
+func (d *Device) WriteMany(ctx context.Context, v *Session, values map[AttrID]string, options ...WriteManyOption) (WriteReport, error) {
+	var config writeManyConfig
+	for _, option := range options {
+		option(&config)
+	}
+
+	registry := d.Registry()
+	report := make(WriteReport, 0, len(values))
+	for attrID, value := range values {
+		report = append(report, WriteResult{
+			AttrID: attrID,
+			Name:   registry.name(attrID),
+			Value:  value,
+			Err:    ErrNotWritten,
+		})
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].AttrID < report[j].AttrID
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	fail := func() {
+		if config.stopOnError {
+			cancel()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for idx := range report {
+		if ctx.Err() != nil {
+			break
+		}
+
+		result := &report[idx]
+		op, err := d.StartWriteData(ctx, v, result.AttrID, result.Value,
+			config.options...)
+		if err != nil {
+			result.Err = err
+			fail()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-op.Done()
+			result.Err = op.Err()
+			if result.Err != nil {
+				fail()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report, report.Err()
+}
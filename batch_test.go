@@ -0,0 +1,129 @@
+package vitotrol_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	td "github.com/maxatome/go-testdeep"
+
+	"github.com/maxatome/go-vitotrol"
+	"github.com/maxatome/go-vitotrol/vitotroltest"
+)
+
+func TestWriteMany(tt *testing.T) {
+	t := td.NewT(tt)
+
+	clock := vitotroltest.NewClock(time.Now())
+
+	fake := vitotroltest.New()
+	fake.Now = clock.Now
+	dev := fake.AddAccount("pipo", "bingo").
+		AddLocation(12, "Home").
+		AddDevice(34, "Boiler")
+	v, d := vitotroltest.NewSessionWithDevice(t, fake, "pipo", "bingo", dev,
+		vitotrol.WithClock(clock), vitotroltest.WithResultErrors())
+
+	values := map[vitotrol.AttrID]string{
+		vitotrol.HeatNormalTemp:       "20",
+		vitotrol.HeatReducedTemp:      "16",
+		vitotrol.PartyModeTemp:        "22",
+		vitotrol.HotWaterSetpointTemp: "55",
+	}
+
+	// All the operations are polled concurrently
+	type writeMany struct {
+		report vitotrol.WriteReport
+		err    error
+	}
+	done := make(chan writeMany)
+	go func() {
+		report, err := d.WriteMany(context.Background(), v, values,
+			vitotrol.WithOperationOptions(vitotrol.WithWait(vitotrol.WaitConfig{
+				First: time.Second,
+			})))
+		done <- writeMany{report, err}
+	}()
+	clock.BlockUntil(len(values))
+	clock.Advance(time.Second)
+
+	res := <-done
+	t.CmpNoError(res.err)
+	// Sorted by AttrID
+	t.Cmp(res.report, td.Smuggle(
+		func(report vitotrol.WriteReport) (ids []vitotrol.AttrID) {
+			for _, result := range report {
+				ids = append(ids, result.AttrID)
+			}
+			return
+		},
+		[]vitotrol.AttrID{
+			vitotrol.HotWaterSetpointTemp,
+			vitotrol.PartyModeTemp,
+			vitotrol.HeatNormalTemp,
+			vitotrol.HeatReducedTemp,
+		}))
+	for _, result := range res.report {
+		t.CmpNoError(result.Err)
+		t.Cmp(result.Value, values[result.AttrID])
+		value, _ := dev.Value(result.AttrID)
+		t.Cmp(value, values[result.AttrID])
+	}
+	t.Nil(res.report.Err())
+	t.Len(res.report.Failed(), 0)
+
+	noWait := vitotrol.WithOperationOptions(vitotrol.WithWait(vitotrol.WaitConfig{
+		First: -1,
+		Min:   -1,
+	}))
+
+	// One write fails, the others go on
+	fake.InjectFault(vitotroltest.Fault{
+		Action:     "WriteData",
+		Result:     vitotroltest.ResultDeviceOffline,
+		ResultText: "Offline",
+		Count:      1,
+	})
+	report, err := d.WriteMany(context.Background(), v, values, noWait)
+	t.CmpErrorIs(err, vitotrol.ErrDeviceOffline)
+	t.Cmp(err, td.Isa(&vitotrol.WriteManyError{}))
+	t.Cmp(err.Error(), td.HasPrefix("1 write(s) failed: HotWaterSetpointTemp: "))
+	t.Cmp(report.Failed(), td.Len(1))
+	t.CmpErrorIs(report[0].Err, vitotrol.ErrDeviceOffline)
+	for _, result := range report[1:] {
+		t.CmpNoError(result.Err)
+	}
+
+	// One write fails, the others are not attempted
+	fake.InjectFault(vitotroltest.Fault{
+		Action:     "WriteData",
+		Result:     vitotroltest.ResultDeviceOffline,
+		ResultText: "Offline",
+		Count:      1,
+	})
+	report, err = d.WriteMany(context.Background(), v, values,
+		noWait, vitotrol.StopOnError())
+	t.CmpErrorIs(err, vitotrol.ErrDeviceOffline)
+	t.CmpErrorIs(err, vitotrol.ErrNotWritten)
+	t.Cmp(report.Failed(), td.Len(len(values)))
+	t.CmpErrorIs(report[0].Err, vitotrol.ErrDeviceOffline)
+	for _, result := range report[1:] {
+		t.CmpErrorIs(result.Err, vitotrol.ErrNotWritten)
+	}
+
+	// Names come from the registry of the device
+	d = &vitotrol.Device{LocationID: 12, DeviceID: 34}
+	ref := *d.Registry().Ref(vitotrol.HotWaterSetpointTemp)
+	ref.Name = "DHWSetpoint"
+	d.Registry().Add(vitotrol.HotWaterSetpointTemp, ref)
+	fake.InjectFault(vitotroltest.Fault{
+		Action:     "WriteData",
+		Result:     vitotroltest.ResultDeviceOffline,
+		ResultText: "Offline",
+		Count:      1,
+	})
+	report, err = d.WriteMany(context.Background(), v, values, noWait)
+	t.Cmp(err.Error(), td.HasPrefix("1 write(s) failed: DHWSetpoint: "))
+	t.Cmp(report[0].Name, "DHWSetpoint")
+	t.Cmp(report[1].Name, "PartyModeTemp")
+}
@@ -0,0 +1,238 @@
+package vitotrol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrNoInteraction is returned by a Replayer when no recorded
+// interaction matches a request.
+var ErrNoInteraction = errors.New("No matching interaction in cassette")
+
+// Interaction is a SOAP exchange recorded in a Cassette. Passwords
+// are redacted from request bodies, and cookie values from the
+// Set-Cookie response headers.
+type Interaction struct {
+	SOAPAction string      `json:"soap_action"`
+	Request    string      `json:"request"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Response   string      `json:"response"`
+}
+
+// Cassette is a list of SOAP exchanges, recorded by a Recorder and
+// served back by a Replayer. It is saved as a JSON file.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// LoadCassette reads the cassette saved in file path.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Cassette
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, fmt.Errorf("Bad cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette in file path.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// Recorder is a http.RoundTripper recording all SOAP exchanges done
+// through it. It is safe for concurrent use. See WithTransport option
+// to use it in a Session.
+type Recorder struct {
+	// Transport is the underlying transport. If nil,
+	// http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder returns a new Recorder sending requests using transport.
+func NewRecorder(transport http.RoundTripper) *Recorder {
+	return &Recorder{Transport: transport}
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{
+		SOAPAction: soapActionName(req),
+		Request:    redactBody(reqBody),
+		StatusCode: resp.StatusCode,
+		Header:     redactHeader(resp.Header),
+		Response:   string(respBody),
+	})
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// redactHeader returns a copy of header whose Set-Cookie values are
+// redacted.
+func redactHeader(header http.Header) http.Header {
+	header = header.Clone()
+	if cookies := header.Values("Set-Cookie"); cookies != nil {
+		header["Set-Cookie"] = redactCookies(cookies)
+	}
+	return header
+}
+
+// Cassette returns a copy of the interactions recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &Cassette{
+		Interactions: append([]*Interaction(nil), r.cassette.Interactions...),
+	}
+}
+
+// Save writes the interactions recorded so far in file path.
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// Replayer is a http.RoundTripper serving back the interactions of a
+// Cassette instead of sending requests. Each interaction is served
+// once, in the recording order. It is safe for concurrent use. See
+// WithTransport option to use it in a Session.
+type Replayer struct {
+	// Match, if not nil, replaces the default matching of requests
+	// against interactions, which compares SOAP actions and request
+	// bodies (with redacted passwords).
+	Match func(soapAction, body string, i *Interaction) bool
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+// NewReplayer returns a new Replayer serving the interactions of
+// cassette.
+func NewReplayer(cassette *Cassette) *Replayer {
+	return &Replayer{
+		cassette: cassette,
+		used:     make([]bool, len(cassette.Interactions)),
+	}
+}
+
+// Remaining returns the number of interactions not served yet.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	num := 0
+	for _, used := range r.used {
+		if !used {
+			num++
+		}
+	}
+	return num
+}
+
+func (r *Replayer) match(soapAction, body string, i *Interaction) bool {
+	if r.Match != nil {
+		return r.Match(soapAction, body, i)
+	}
+	return i.SOAPAction == soapAction && i.Request == body
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	soapAction := soapActionName(req)
+	body := redactBody(reqBody)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for idx, i := range r.cassette.Interactions {
+		if r.used[idx] || !r.match(soapAction, body, i) {
+			continue
+		}
+		r.used[idx] = true
+
+		header := i.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", i.StatusCode, http.StatusText(i.StatusCode)),
+			StatusCode:    i.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(i.Response)),
+			ContentLength: int64(len(i.Response)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrNoInteraction, soapAction)
+}
+
+// soapActionName returns the SOAP action of req without its namespace.
+func soapActionName(req *http.Request) string {
+	action := req.Header.Get("SOAPAction")
+	return action[strings.LastIndex(action, "/")+1:]
+}
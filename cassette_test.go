@@ -0,0 +1,122 @@
+package vitotrol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+func TestCassette(tt *testing.T) {
+	t := td.NewT(tt)
+
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch soapActionName(r) {
+			case "Login":
+				w.Header().Add("Set-Cookie", "sid=1234")
+				fmt.Fprintln(w, respHeader+`<LoginResponse><LoginResult>
+<Ergebnis>0</Ergebnis><ErgebnisText>Kein Fehler</ErgebnisText>
+<Vorname>Maxime</Vorname>
+</LoginResult></LoginResponse>`+respFooter)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintln(w, respHeader+`<soap:Fault>
+  <faultcode>soap:Client</faultcode>
+  <faultstring>Unknown SOAPAction</faultstring>
+</soap:Fault>`+respFooter)
+			}
+		}))
+	defer ts.Close()
+
+	// Record
+	recorder := NewRecorder(nil)
+	v := NewSession(WithEndpoint(ts.URL), WithTransport(recorder))
+	t.CmpNoError(v.Login("pipo", "bingo"))
+	d := &Device{DeviceID: 12, LocationID: 34}
+	_, err := d.GetTypeInfo(v)
+	t.Isa(err, &SOAPFault{})
+
+	cassette := recorder.Cassette()
+	t.Cmp(cassette.Interactions, td.Slice([]*Interaction{}, td.ArrayEntries{
+		0: td.Struct(&Interaction{
+			SOAPAction: "Login",
+			StatusCode: 200,
+		}, td.StructFields{
+			"Request":  td.Contains("<Passwort>REDACTED</Passwort>"),
+			"Header":   td.SuperMapOf(http.Header{"Set-Cookie": {"sid=REDACTED"}}, nil),
+			"Response": td.Contains("<Vorname>Maxime</Vorname>"),
+		}),
+		1: td.Struct(&Interaction{
+			SOAPAction: "GetTypeInfo",
+			StatusCode: 500,
+		}, td.StructFields{
+			"Request":  td.Contains("<GeraetId>12</GeraetId>"),
+			"Response": td.Contains("Unknown SOAPAction"),
+		}),
+	}))
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if !t.CmpNoError(recorder.Save(path)) {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if t.CmpNoError(err) {
+		t.False(strings.Contains(string(data), "bingo"), "password redacted")
+		t.False(strings.Contains(string(data), "1234"), "cookie redacted")
+	}
+
+	loaded, err := LoadCassette(path)
+	if !t.CmpNoError(err) {
+		return
+	}
+	t.Cmp(loaded, cassette)
+
+	// Replay, the server is no longer needed
+	ts.Close()
+
+	replayer := NewReplayer(loaded)
+	t.Cmp(replayer.Remaining(), 2)
+
+	v = NewSession(WithEndpoint(ts.URL), WithTransport(replayer))
+	t.CmpNoError(v.Login("pipo", "other password"))
+	t.Cmp(v.CookiesSnapshot(), []string{"sid=REDACTED"})
+	_, err = d.GetTypeInfo(v)
+	t.Isa(err, &SOAPFault{})
+	t.Cmp(replayer.Remaining(), 0)
+
+	// Each interaction is served once
+	err = v.Login("pipo", "bingo")
+	t.True(errors.Is(err, ErrNoInteraction))
+
+	// Request body mismatch
+	replayer = NewReplayer(loaded)
+	v = NewSession(WithEndpoint(ts.URL), WithTransport(replayer))
+	_, err = (&Device{DeviceID: 56, LocationID: 34}).
+		GetTypeInfoContext(context.Background(), v)
+	t.True(errors.Is(err, ErrNoInteraction))
+
+	// Custom matching
+	replayer.Match = func(soapAction, _ string, i *Interaction) bool {
+		return i.SOAPAction == soapAction
+	}
+	_, err = (&Device{DeviceID: 56, LocationID: 34}).
+		GetTypeInfoContext(context.Background(), v)
+	t.Isa(err, &SOAPFault{})
+
+	// Bad cassettes
+	_, err = LoadCassette(filepath.Join(t.TempDir(), "unknown.json"))
+	t.CmpError(err)
+
+	path = filepath.Join(t.TempDir(), "bad.json")
+	t.CmpNoError(os.WriteFile(path, []byte("{"), 0o600))
+	_, err = LoadCassette(path)
+	t.CmpError(err)
+}
@@ -0,0 +1,77 @@
+package vitotrol
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time of a Session, used by the polling of
+// asynchronous operations, their timeouts, the retry backoffs and
+// the TokenBucket rate limiter. See WithClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a new Timer firing after at least d.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer created by a Clock.
+type Timer interface {
+	// C returns the channel on which the current time is sent when
+	// the timer fires.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing. It returns false if the
+	// timer already fired or has been stopped.
+	Stop() bool
+}
+
+// SystemClock is the Clock based on the time package, used by
+// default.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// WithClock sets the clock of the session. See Session.Clock.
+func WithClock(clock Clock) Option {
+	return func(v *Session) {
+		v.Clock = clock
+	}
+}
+
+func (v *Session) clock() Clock {
+	if v.Clock != nil {
+		return v.Clock
+	}
+	return SystemClock
+}
+
+// sleepContext pauses the current goroutine for at least the
+// duration d according to clock or until ctx is done. In the latter
+// case, the ctx error is returned.
+func sleepContext(ctx context.Context, clock Clock, d time.Duration) error {
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
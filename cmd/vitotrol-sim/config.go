@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/maxatome/go-vitotrol"
+	"github.com/maxatome/go-vitotrol/vitotroltest"
+)
+
+// duration is a time.Duration read from a JSON string like "1m30s".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var str string
+	err := json.Unmarshal(b, &str)
+	if err != nil {
+		return err
+	}
+	dur, err := time.ParseDuration(str)
+	if err != nil {
+		return err
+	}
+	*d = duration(dur)
+	return nil
+}
+
+type config struct {
+	Accounts []accountConfig `json:"accounts"`
+	Faults   []faultConfig   `json:"faults"`
+}
+
+type accountConfig struct {
+	Login     string           `json:"login"`
+	Password  string           `json:"password"`
+	Firstname string           `json:"firstname"`
+	Lastname  string           `json:"lastname"`
+	Locations []locationConfig `json:"locations"`
+}
+
+type locationConfig struct {
+	ID      uint32         `json:"id"`
+	Name    string         `json:"name"`
+	Devices []deviceConfig `json:"devices"`
+}
+
+type deviceConfig struct {
+	ID      uint32 `json:"id"`
+	Name    string `json:"name"`
+	Offline bool   `json:"offline"`
+	// Attribute name or ID → Vitodata raw value
+	Values map[string]string `json:"values"`
+	// Timesheet name or ID → day → slots
+	Timesheets        map[string]map[string]vitotrol.TimeslotSlice `json:"timesheets"`
+	Errors            []errorConfig                                `json:"errors"`
+	RefreshStatuses   []int                                        `json:"refresh_statuses"`
+	WriteStatuses     []int                                        `json:"write_statuses"`
+	OperationDuration duration                                     `json:"operation_duration"`
+}
+
+type errorConfig struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Time    string `json:"time"` // 2006-01-02 15:04:05
+	Active  bool   `json:"active"`
+}
+
+type faultConfig struct {
+	Action         string   `json:"action"`
+	Delay          duration `json:"delay"`
+	ExpireSessions bool     `json:"expire_sessions"`
+	HTTPStatus     int      `json:"http_status"`
+	Result         int      `json:"result"`
+	ResultText     string   `json:"result_text"`
+	Count          int      `json:"count"`
+}
+
+func loadConfig(file string) (*config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var conf config
+	err = json.Unmarshal(data, &conf)
+	if err != nil {
+		return nil, fmt.Errorf("Bad config file `%s': %s", file, err)
+	}
+	return &conf, nil
+}
+
+func attrID(name string) (vitotrol.AttrID, error) {
+	if id, ok := vitotrol.AttributesNames2IDs[name]; ok {
+		return id, nil
+	}
+	id, err := strconv.ParseUint(name, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("unknown attribute `%s'", name)
+	}
+	return vitotrol.AttrID(id), nil
+}
+
+func timesheetID(name string) (vitotrol.TimesheetID, error) {
+	if id, ok := vitotrol.TimesheetsNames2IDs[name]; ok {
+		return id, nil
+	}
+	id, err := strconv.ParseUint(name, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("unknown timesheet `%s'", name)
+	}
+	return vitotrol.TimesheetID(id), nil
+}
+
+// attributeInfo returns the GetTypeInfo description of id, using
+// vitotrol.AttributesRef.
+func attributeInfo(id vitotrol.AttrID) *vitotrol.AttributeInfo {
+	info := &vitotrol.AttributeInfo{
+		AttributeID: id,
+		AttributeInfoBase: vitotrol.AttributeInfoBase{
+			AttributeName: strconv.Itoa(int(id)),
+			AttributeType: vitotrol.TypeString.Type(),
+			Readable:      true,
+		},
+	}
+
+	ref := vitotrol.AttributesRef[id]
+	if ref == nil {
+		return info
+	}
+
+	info.AttributeName = ref.Name
+	info.Readable = ref.Access&vitotrol.ReadOnly != 0
+	info.Writable = ref.Access&vitotrol.WriteOnly != 0
+
+	if enum, ok := ref.Type.(*vitotrol.VitodataEnum); ok {
+		info.AttributeType = "ENUM"
+		info.EnumValues = map[uint32]string{}
+		for idx := uint32(0); ; idx++ {
+			value, err := enum.Vitodata2HumanValue(strconv.Itoa(int(idx)))
+			if err != nil {
+				break
+			}
+			info.EnumValues[idx] = value
+		}
+	} else {
+		info.AttributeType = ref.Type.Type()
+	}
+
+	if ref.Range != nil {
+		info.MinValue = strconv.FormatFloat(ref.Range.Min, 'f', -1, 64)
+		info.MaxValue = strconv.FormatFloat(ref.Range.Max, 'f', -1, 64)
+	}
+	return info
+}
+
+// fake returns a new vitotroltest.Fake initialized with conf.
+func (conf *config) fake() (*vitotroltest.Fake, error) {
+	fake := vitotroltest.New()
+
+	for _, ac := range conf.Accounts {
+		account := fake.AddAccount(ac.Login, ac.Password).
+			SetName(ac.Firstname, ac.Lastname)
+
+		for _, lc := range ac.Locations {
+			location := account.AddLocation(lc.ID, lc.Name)
+
+			for _, dc := range lc.Devices {
+				err := dc.fill(location.AddDevice(dc.ID, dc.Name))
+				if err != nil {
+					return nil, fmt.Errorf("device %d@%d: %s", dc.ID, lc.ID, err)
+				}
+			}
+		}
+	}
+
+	for _, fc := range conf.Faults {
+		fake.InjectFault(vitotroltest.Fault{
+			Action:         fc.Action,
+			Delay:          time.Duration(fc.Delay),
+			ExpireSessions: fc.ExpireSessions,
+			HTTPStatus:     fc.HTTPStatus,
+			Result:         fc.Result,
+			ResultText:     fc.ResultText,
+			Count:          fc.Count,
+		})
+	}
+
+	return fake, nil
+}
+
+func (dc *deviceConfig) fill(d *vitotroltest.Device) error {
+	d.SetOffline(dc.Offline).
+		SetOperationDuration(time.Duration(dc.OperationDuration))
+
+	if dc.RefreshStatuses != nil {
+		d.SetRefreshStatuses(dc.RefreshStatuses...)
+	}
+	if dc.WriteStatuses != nil {
+		d.SetWriteStatuses(dc.WriteStatuses...)
+	}
+
+	var infos []*vitotrol.AttributeInfo
+	for name, value := range dc.Values {
+		id, err := attrID(name)
+		if err != nil {
+			return err
+		}
+		d.SetValue(id, value)
+		infos = append(infos, attributeInfo(id))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].AttributeID < infos[j].AttributeID
+	})
+	d.SetTypeInfo(infos)
+
+	for name, timesheet := range dc.Timesheets {
+		id, err := timesheetID(name)
+		if err != nil {
+			return err
+		}
+		d.SetTimesheet(id, timesheet)
+	}
+
+	for _, ec := range dc.Errors {
+		tm, err := vitotrol.ParseVitotrolTime(ec.Time)
+		if err != nil {
+			return fmt.Errorf("error %s: bad time `%s'", ec.Code, ec.Time)
+		}
+		d.AddError(vitotrol.ErrorHistoryEvent{
+			Error:    ec.Code,
+			Message:  ec.Message,
+			Time:     tm,
+			IsActive: ec.Active,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	td "github.com/maxatome/go-testdeep"
+
+	"github.com/maxatome/go-vitotrol"
+	"github.com/maxatome/go-vitotrol/vitotroltest"
+)
+
+func TestExampleConfig(tt *testing.T) {
+	t := td.NewT(tt)
+
+	conf, err := loadConfig("example.json")
+	if !t.CmpNoError(err) {
+		return
+	}
+
+	fake, err := conf.fake()
+	if !t.CmpNoError(err) {
+		return
+	}
+
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	v := vitotrol.NewSession(vitotrol.WithEndpoint(srv.URL),
+		vitotroltest.WithResultErrors())
+	t.CmpNoError(v.Login("demo", "demo"))
+	if !t.CmpNoError(v.GetDevices()) {
+		return
+	}
+	devices := v.DevicesList()
+	if !t.Len(devices, 1) {
+		return
+	}
+	d := devices[0]
+	t.Cmp(d.DeviceName, "Vitodens")
+
+	// Injected fault, only once
+	attrs := []vitotrol.AttrID{vitotrol.IndoorTemp, vitotrol.BurnerState}
+	t.CmpErrorIs(d.GetData(v, attrs), vitotrol.ErrServerBusy)
+	if t.CmpNoError(d.GetData(v, attrs)) {
+		value, _ := d.Attribute(vitotrol.IndoorTemp)
+		t.Cmp(value.Value, "21.5")
+	}
+
+	infos, err := d.GetTypeInfo(v)
+	if t.CmpNoError(err) {
+		t.Cmp(infos, td.Bag(
+			td.Struct(&vitotrol.AttributeInfo{
+				AttributeID: vitotrol.BurnerState,
+				EnumValues:  map[uint32]string{0: "off", 1: "on"},
+			}, td.StructFields{
+				"AttributeInfoBase": td.SStruct(vitotrol.AttributeInfoBase{
+					AttributeName: "BurnerState",
+					AttributeType: "ENUM",
+					Readable:      true,
+				}, nil),
+			}),
+			td.Struct(&vitotrol.AttributeInfo{AttributeID: vitotrol.IndoorTemp}, td.StructFields{
+				"AttributeInfoBase": td.SStruct(vitotrol.AttributeInfoBase{
+					AttributeName: "IndoorTemp",
+					AttributeType: "Double",
+					Readable:      true,
+				}, nil),
+			}),
+			td.Struct(&vitotrol.AttributeInfo{AttributeID: vitotrol.OutdoorTemp}, nil),
+		))
+	}
+
+	if t.CmpNoError(d.GetTimesheetData(v, vitotrol.HeatingTimesheet)) {
+		timesheet, _ := d.Timesheet(vitotrol.HeatingTimesheet)
+		t.Cmp(timesheet, map[string]vitotrol.TimeslotSlice{
+			"mon": {{From: 600, To: 2200}},
+			"sat": {{From: 800, To: 2300}},
+		})
+	}
+}
+
+func TestBadConfig(tt *testing.T) {
+	t := td.NewT(tt)
+
+	_, err := loadConfig(filepath.Join(t.TempDir(), "unknown.json"))
+	t.CmpError(err)
+
+	for _, content := range []string{
+		`{`,
+		`{"faults":[{"delay":"1 hour"}]}`,
+	} {
+		file := filepath.Join(t.TempDir(), "config.json")
+		t.CmpNoError(os.WriteFile(file, []byte(content), 0o600))
+		_, err = loadConfig(file)
+		t.CmpError(err, content)
+	}
+
+	for _, device := range []deviceConfig{
+		{Values: map[string]string{"Unknown": "1"}},
+		{Timesheets: map[string]map[string]vitotrol.TimeslotSlice{"Unknown": nil}},
+		{Errors: []errorConfig{{Code: "F4", Time: "yesterday"}}},
+	} {
+		conf := config{Accounts: []accountConfig{{
+			Locations: []locationConfig{{Devices: []deviceConfig{device}}},
+		}}}
+		_, err = conf.fake()
+		t.CmpError(err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/maxatome/go-vitotrol/vitotroltest"
+)
+
+// printResultCodes prints the result codes of the simulator and the
+// errors they are mapped to.
+func printResultCodes() {
+	codes := make([]int, 0, len(vitotroltest.ResultErrors))
+	for code := range vitotroltest.ResultErrors {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	for _, code := range codes {
+		fmt.Fprintf(os.Stderr, "  %3d  %s\n", code, vitotroltest.ResultErrors[code])
+	}
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [OPTIONS] CONFIG_FILE\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, `
+Serves the Vitotrol™ SOAP API on LISTEN address, simulating the
+accounts, devices, datapoints and faults described in the JSON
+CONFIG_FILE. See example.json in the source directory.
+
+The result codes replied, including the "result" ones of faults, are:`)
+		printResultCodes()
+		fmt.Fprintln(os.Stderr, `
+Clients have to map them to errors, as vitotrol -fake-codes does or
+using the vitotroltest.WithResultErrors option, to re-login or retry
+accordingly.`)
+	}
+
+	listen := flag.String("listen", "localhost:8080", "address to listen on")
+	verbose := flag.Bool("verbose", false, "log each received request")
+
+	flag.Parse()
+
+	if len(flag.Args()) != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	conf, err := loadConfig(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "***", err)
+		os.Exit(1)
+	}
+
+	fake, err := conf.fake()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "***", err)
+		os.Exit(1)
+	}
+
+	var handler http.Handler = fake
+	if *verbose {
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			action := r.Header.Get("SOAPAction")
+			log.Printf("%s %s", r.RemoteAddr, action[strings.LastIndex(action, "/")+1:])
+			fake.ServeHTTP(w, r)
+		})
+	}
+
+	log.Printf("Vitotrol™ simulator listening on http://%s/", *listen)
+	err = http.ListenAndServe(*listen, handler)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "***", err)
+		os.Exit(1)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,16 +10,9 @@ import (
 	"strings"
 
 	"github.com/maxatome/go-vitotrol"
+	"github.com/maxatome/go-vitotrol/vitotroltest"
 )
 
-func existTimesheetName(tsName string) (vitotrol.TimesheetID, error) {
-	tID, ok := vitotrol.TimesheetsNames2IDs[tsName]
-	if !ok {
-		return 0, fmt.Errorf("unknown timesheet `%s'", tsName)
-	}
-	return tID, nil
-}
-
 // An Action can be typically called by main to do a job.
 type Action interface {
 	// NeedAuth tells whether this Action needs an authentication or not.
@@ -50,9 +44,20 @@ type authAction struct {
 }
 
 func (a *authAction) initVitotrol(pOptions *Options) error {
-	v := &vitotrol.Session{
-		Debug: pOptions.debug,
+	opts := []vitotrol.Option{vitotrol.WithDebug(pOptions.debug)}
+	if pOptions.endpoint != "" {
+		opts = append(opts, vitotrol.WithEndpoint(pOptions.endpoint))
+	}
+	if pOptions.fakeCodes {
+		opts = append(opts, vitotroltest.WithResultErrors())
+	}
+	if pOptions.retry {
+		opts = append(opts, vitotrol.WithRetryPolicy(vitotrol.DefaultRetryPolicy))
 	}
+	if pOptions.verify {
+		opts = append(opts, vitotrol.WithVerifiedWrites())
+	}
+	v := vitotrol.NewSession(opts...)
 
 	err := v.Login(pOptions.login, pOptions.password)
 	if err != nil {
@@ -63,40 +68,41 @@ func (a *authAction) initVitotrol(pOptions *Options) error {
 	if err != nil {
 		return fmt.Errorf("GetDevices failed: %s", err)
 	}
-	if len(v.Devices) == 0 {
+	devices := v.DevicesList()
+	if len(devices) == 0 {
 		return errors.New("No device found")
 	}
 
 	if !a.noDefaultDev {
 		var pDevice *vitotrol.Device
 		if pOptions.device == "" {
-			pDevice = &v.Devices[0]
+			pDevice = devices[0]
 		} else if idx, err := strconv.Atoi(pOptions.device); err == nil {
 			// Check if a device exists with this ID
-			for _, device := range v.Devices {
+			for _, device := range devices {
 				if uint32(idx) == device.DeviceID {
-					pDevice = &device //nolint: exportloopref
+					pDevice = device
 					break
 				}
 			}
 
 			// Else, take it as an index in devices array
 			if pDevice == nil {
-				if idx >= len(v.Devices) {
+				if idx >= len(devices) {
 					return fmt.Errorf(
 						"%d is not a device ID and too big to be an index "+
 							"(>= %d available devices).",
-						idx, len(v.Devices))
+						idx, len(devices))
 				}
-				pDevice = &v.Devices[idx]
+				pDevice = devices[idx]
 			}
 		} else {
 			checkDevLoc := strings.ContainsRune(pOptions.device, '@')
 
 			// Check if a device exists with this name
-			for _, device := range v.Devices {
+			for _, device := range devices {
 				if pOptions.device == device.DeviceName {
-					pDevice = &device //nolint: exportloopref
+					pDevice = device
 					break
 				}
 
@@ -105,13 +111,13 @@ func (a *authAction) initVitotrol(pOptions *Options) error {
 					// DeviceId@LocationID
 					if pOptions.device == fmt.Sprintf("%d@%d",
 						device.DeviceID, device.LocationID) {
-						pDevice = &device //nolint: exportloopref
+						pDevice = device
 						break
 					}
 
 					// DeviceName@LocationName
 					if pOptions.device == device.DeviceName+"@"+device.LocationName {
-						pDevice = &device //nolint: exportloopref
+						pDevice = device
 						break
 					}
 				}
@@ -149,13 +155,14 @@ func (f *foreignAttrs) checkAttributeAccess(attrName string, reqAccess vitotrol.
 	var attrID vitotrol.AttrID
 	var ok bool
 
+	registry := f.d.Registry()
 	for {
 		id, err := strconv.ParseUint(attrName, 0, 16)
 		if err == nil {
 			attrID = vitotrol.AttrID(id)
-			_, ok = vitotrol.AttributesRef[attrID]
+			ok = registry.Ref(attrID) != nil
 		} else {
-			attrID, ok = vitotrol.AttributesNames2IDs[attrName]
+			attrID, ok = registry.ID(attrName)
 		}
 
 		if ok || f.cachePopulated {
@@ -168,7 +175,7 @@ func (f *foreignAttrs) checkAttributeAccess(attrName string, reqAccess vitotrol.
 		return vitotrol.NoAttr, fmt.Errorf("unknown attribute `%s'", attrName)
 	}
 
-	if (vitotrol.AttributesRef[attrID].Access & reqAccess) != reqAccess {
+	if (registry.Ref(attrID).Access & reqAccess) != reqAccess {
 		return vitotrol.NoAttr, fmt.Errorf("attribute `%s' is not %s",
 			attrName, vitotrol.AccessToStr[reqAccess])
 	}
@@ -176,61 +183,45 @@ func (f *foreignAttrs) checkAttributeAccess(attrName string, reqAccess vitotrol.
 	return attrID, nil
 }
 
+func (f *foreignAttrs) checkTimesheetName(tsName string) (vitotrol.TimesheetID, error) {
+	var tID vitotrol.TimesheetID
+	var ok bool
+
+	registry := f.d.Registry()
+	for {
+		id, err := strconv.ParseUint(tsName, 0, 16)
+		if err == nil {
+			tID = vitotrol.TimesheetID(id)
+			ok = registry.Timesheet(tID) != nil
+		} else {
+			tID, ok = registry.TimesheetID(tsName)
+		}
+
+		if ok || f.cachePopulated {
+			break
+		}
+		f.populateCache()
+	}
+
+	if !ok {
+		return 0, fmt.Errorf("unknown timesheet `%s'", tsName)
+	}
+	return tID, nil
+}
+
 func (f *foreignAttrs) populateCache() {
 	f.cachePopulated = true
 
-	attrs, err := f.d.GetTypeInfo(f.v)
+	discovered, err := f.d.DiscoverAttributes(context.Background(), f.v)
 	if err != nil {
 		fmt.Printf("GetTypeInfo failed: %s", err)
 		return
 	}
 
-	for _, pAttrInfo := range attrs {
-		attrID := pAttrInfo.AttributeID
-		if vitotrol.AttributesRef[attrID] == nil {
-			// Unknown attribute
-			pType := vitotrol.TypeNames[pAttrInfo.AttributeType]
-			if pType == nil {
-				if pAttrInfo.AttributeType != "ENUM" {
-					// No warning for type used for timesheets...
-					if pAttrInfo.AttributeType != "CircuitTime" {
-						fmt.Printf("populateCache: unrecognized type %s for attribute "+
-							"%s-0x%04x. Discard it.\n",
-							pAttrInfo.AttributeType, pAttrInfo.AttributeName, attrID)
-					}
-					continue
-				}
-
-				var maxIdx uint32
-				for idx := range pAttrInfo.EnumValues {
-					if idx > maxIdx {
-						maxIdx = idx
-					}
-				}
-				enumValues := make([]string, maxIdx+1)
-				for idx, value := range pAttrInfo.EnumValues {
-					enumValues[idx] = value
-				}
-				pType = vitotrol.NewEnum(enumValues)
-			}
-
-			ref := vitotrol.AttrRef{
-				Type: pType,
-				Name: fmt.Sprintf("%s-0x%04x", pAttrInfo.AttributeName, attrID),
-				Doc:  pAttrInfo.AttributeName,
-			}
-
-			if pAttrInfo.Readable {
-				ref.Access = vitotrol.ReadOnly
-			}
-			if pAttrInfo.Writable {
-				ref.Access |= vitotrol.WriteOnly
-			}
-
-			vitotrol.AttributesRef[attrID] = &ref
-			vitotrol.AttributesNames2IDs[ref.Name] = attrID
-			vitotrol.Attributes = append(vitotrol.Attributes, attrID)
-		}
+	for _, pAttrInfo := range discovered.Unsupported {
+		fmt.Printf("populateCache: unrecognized type %s for attribute "+
+			"%s-0x%04x. Discard it.\n",
+			pAttrInfo.AttributeType, pAttrInfo.AttributeName, pAttrInfo.AttributeID)
 	}
 }
 
@@ -245,7 +236,7 @@ func (a *devicesAction) Do(pOptions *Options, _ []string) error {
 		return err
 	}
 
-	for idx, device := range a.v.Devices {
+	for idx, device := range a.v.DevicesList() {
 		fmt.Printf(`Index %d
   LocationName (LocationID): %s (%d)
       DeviceName (DeviceID): %s (%d)
@@ -308,13 +299,14 @@ func (a *getAction) Do(pOptions *Options, params []string) error {
 	// Special case -> all attributes
 	if len(params) == 1 && params[0] == "all" {
 		a.populateCache()
-		attrs = vitotrol.Attributes
+		attrs = a.d.Registry().IDs()
 	} else {
 		var err error
 		attrs = make([]vitotrol.AttrID, len(params))
 
 		if a.bget {
 			a.populateCache()
+			registry := a.d.Registry()
 
 			var id uint64
 			for idx, attrName := range params {
@@ -325,12 +317,12 @@ func (a *getAction) Do(pOptions *Options, params []string) error {
 				attrs[idx] = vitotrol.AttrID(id)
 
 				// Create a fake String entry for this attribute
-				if _, ok := vitotrol.AttributesRef[vitotrol.AttrID(id)]; !ok {
-					vitotrol.AttributesRef[vitotrol.AttrID(id)] = &vitotrol.AttrRef{
+				if registry.Ref(vitotrol.AttrID(id)) == nil {
+					registry.Add(vitotrol.AttrID(id), vitotrol.AttrRef{
 						Type:   vitotrol.TypeString,
 						Access: vitotrol.ReadOnly,
 						Name:   fmt.Sprintf("0x%04x", id),
-					}
+					})
 				}
 			}
 		} else {
@@ -385,7 +377,10 @@ func (a *setAction) Do(pOptions *Options, params []string) error {
 			return err
 		}
 
-		value, err := vitotrol.AttributesRef[attrID].Type.Human2VitodataValue(params[idx+1])
+		value, err := a.d.Registry().Ref(attrID).Human2VitodataValue(params[idx+1])
+		if err == nil {
+			err = a.d.ValidateValue(attrID, value)
+		}
 		if err != nil {
 			return fmt.Errorf("value `%s' of attribute %s is invalid: %s",
 				params[idx+1], params[idx], err)
@@ -394,23 +389,22 @@ func (a *setAction) Do(pOptions *Options, params []string) error {
 		attrsValues[attrID] = value
 	}
 
-	// Set them all
-	for attrID, value := range attrsValues {
-		ch, err := a.d.WriteDataWait(a.v, attrID, value)
-		if err != nil {
-			return fmt.Errorf("WriteData error: %s", err)
-		}
+	// Set them all, stopping at the first failure
+	report, err := a.d.WriteMany(context.Background(), a.v, attrsValues,
+		vitotrol.StopOnError())
 
-		if err = <-ch; err != nil {
-			return fmt.Errorf("WriteData failed: %s", err)
-		}
-
-		if pOptions.verbose {
-			fmt.Printf("%s attribute successfully set to `%s'\n",
-				vitotrol.AttributesRef[attrID].Name, value)
+	if pOptions.verbose {
+		for _, result := range report {
+			if result.Err == nil {
+				fmt.Printf("%s attribute successfully set to `%s'\n",
+					a.d.Registry().Ref(result.AttrID).Name, result.Value)
+			}
 		}
 	}
 
+	if err != nil {
+		return fmt.Errorf("WriteData failed: %s", err)
+	}
 	return nil
 }
 
@@ -430,11 +424,12 @@ func (a *errorsAction) Do(pOptions *Options, _ []string) error {
 		return fmt.Errorf("GetErrorHistory error: %s", err)
 	}
 
-	if len(a.d.Errors) == 0 {
+	errs := a.d.ErrorsSnapshot()
+	if len(errs) == 0 {
 		fmt.Println("No errors")
 	} else {
-		fmt.Printf("%d error(s):\n", len(a.d.Errors))
-		for _, error := range a.d.Errors {
+		fmt.Printf("%d error(s):\n", len(errs))
+		for _, error := range errs {
 			fmt.Println("-", &error)
 		}
 	}
@@ -444,7 +439,7 @@ func (a *errorsAction) Do(pOptions *Options, _ []string) error {
 
 // setTimesheetAction implements the "set_timesheet" action.
 type setTimesheetAction struct {
-	authAction
+	foreignAttrs
 }
 
 func (a *setTimesheetAction) Do(pOptions *Options, params []string) error {
@@ -454,11 +449,6 @@ func (a *setTimesheetAction) Do(pOptions *Options, params []string) error {
 
 	var err error
 
-	tID, err := existTimesheetName(params[0])
-	if err != nil {
-		return err
-	}
-
 	if len(params) == 1 {
 		return errors.New("JSON definition of timesheet is missing")
 	}
@@ -482,6 +472,11 @@ func (a *setTimesheetAction) Do(pOptions *Options, params []string) error {
 		return err
 	}
 
+	tID, err := a.checkTimesheetName(params[0])
+	if err != nil {
+		return err
+	}
+
 	ch, err := a.d.WriteTimesheetDataWait(a.v, tID, tss)
 	if err != nil {
 		return fmt.Errorf("WriteTimesheetData error: %s", err)
@@ -496,7 +491,7 @@ func (a *setTimesheetAction) Do(pOptions *Options, params []string) error {
 
 // timesheetAction implements the "timesheet" action.
 type timesheetAction struct {
-	authAction
+	foreignAttrs
 }
 
 func (a *timesheetAction) Do(pOptions *Options, params []string) error {
@@ -504,33 +499,31 @@ func (a *timesheetAction) Do(pOptions *Options, params []string) error {
 		return errors.New("timesheet name is missing")
 	}
 
-	var err error
+	err := a.initVitotrol(pOptions)
+	if err != nil {
+		return err
+	}
 
 	timesheetIDs := make([]vitotrol.TimesheetID, len(params))
 	for idx, name := range params {
-		timesheetIDs[idx], err = existTimesheetName(name)
+		timesheetIDs[idx], err = a.checkTimesheetName(name)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = a.initVitotrol(pOptions)
-	if err != nil {
-		return err
-	}
-
 	for _, tID := range timesheetIDs {
 		err := a.d.GetTimesheetData(a.v, tID)
 		if err != nil {
 			return fmt.Errorf("GetTimesheetData error: %s", err)
 		}
 
-		ts := a.d.Timesheets[tID]
+		ts, _ := a.d.Timesheet(tID)
 		if a.options.jsonOutput {
 			buf, _ := json.Marshal(ts)
 			fmt.Println(string(buf))
 		} else {
-			fmt.Println(vitotrol.TimesheetsRef[tID])
+			fmt.Println(a.d.Registry().Timesheet(tID))
 			for _, day := range []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"} {
 				fmt.Printf("- %s:\n", day)
 				for _, slot := range ts[day] {
@@ -16,6 +16,10 @@ type Options struct {
 	debug      bool
 	jsonOutput bool
 	device     string
+	endpoint   string
+	fakeCodes  bool
+	retry      bool
+	verify     bool
 }
 
 func main() {
@@ -38,7 +42,10 @@ ACTION & PARAMS can be:
 - rbget ATTR_IDX ...   refresh then get the value of attributes ATTR_IDX, ...
                          on vitodata server without checking their validity
                          before (for developing purpose)
-- set ATTR_NAME VALUE  set the value of attribute ATTR_NAME to VALUE
+- set ATTR_NAME VALUE ...
+                       set the value of attribute ATTR_NAME to VALUE, ...
+                         all the writes being done concurrently
+                         VALUE can be suffixed by a unit (eg. 72F or 295K)
 - timesheet TIMESHEET ...
                        get the timesheet TIMESHEET data
 - set_timesheet TIMESHEET '{"wday":[{"from":630,"to":2200},...],...}'
@@ -59,8 +66,17 @@ ACTION & PARAMS can be:
 	flag.StringVar(&options.device, "device", "0",
 		"DeviceID, index, DeviceName, "+
 			"DeviceId@LocationID, DeviceName@LocationName (see `devices' action)")
+	flag.StringVar(&options.endpoint, "endpoint", "",
+		"Vitodata API URL (eg. a vitotrol-sim one), default to the Viessmann one")
+	flag.BoolVar(&options.fakeCodes, "fake-codes", false,
+		"used with -endpoint to understand the result codes of a vitotrol-sim "+
+			"server (expired session, server busy, etc.)")
+	flag.BoolVar(&options.retry, "retry", false,
+		"retry requests failing with a transient error (eg. server busy)")
 	flag.BoolVar(&options.verbose, "verbose", false, "print verbose information")
 	flag.BoolVar(&options.debug, "debug", false, "print debug information")
+	flag.BoolVar(&options.verify, "verify", false,
+		"used by `set' action to read back written values")
 	flag.BoolVar(&options.jsonOutput, "json", false,
 		"used by `timesheet' action to display timesheets using JSON format")
 
@@ -71,6 +87,11 @@ ACTION & PARAMS can be:
 		os.Exit(1)
 	}
 
+	if options.fakeCodes && options.endpoint == "" {
+		fmt.Fprintln(os.Stderr, "*** -fake-codes needs -endpoint")
+		os.Exit(1)
+	}
+
 	actionName, params := flag.Args()[0], flag.Args()[1:]
 
 	action := actions[actionName]
@@ -2,16 +2,30 @@ package vitotrol
 
 import (
 	"bytes"
+	"context"
+	"encoding/xml"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Device represents one Vitotrol™ device (a priori a boiler).
+//
+// A Device is safe for concurrent use by multiple goroutines as long
+// as its Attributes, Timesheets and Errors caches are not directly
+// accessed. Use Attribute, AttributesSnapshot, Timesheet,
+// TimesheetsSnapshot and ErrorsSnapshot instead. A Device must not be
+// copied after first use.
+//
+// Devices of a Session are updated in place by Session.GetDevices, so
+// their LocationName, DeviceName, HasError and IsConnected fields
+// must not be directly accessed either while other goroutines can
+// call it. Use Info instead.
 type Device struct {
 	LocationID   uint32 // Vitotrol™ ID of location (AnlageId field)
 	LocationName string // location name (AnlageName field)
@@ -26,23 +40,146 @@ type Device struct {
 	Timesheets map[TimesheetID]map[string]TimeslotSlice
 	// cache of last read errors (filled by GetErrorHistory)
 	Errors []ErrorHistoryEvent
+
+	registry *AttributeRegistry
+
+	mu sync.RWMutex // protects Attributes, Timesheets, Errors, registry & infos
+}
+
+// DeviceInfo describes a device as returned by the GetDevices
+// request. See Device.Info.
+type DeviceInfo struct {
+	LocationID   uint32 // Vitotrol™ ID of location (AnlageId field)
+	LocationName string // location name (AnlageName field)
+	DeviceID     uint32 // Vitotrol™ ID of device (GeraetId field)
+	DeviceName   string // device name (GeraetName field)
+	HasError     bool   // ORed HatFehler field of Device & Location
+	IsConnected  bool   // IstVerbunden field of Device
+}
+
+// Info returns a copy of the informations about the device, as
+// last updated by Session.GetDevices.
+func (d *Device) Info() DeviceInfo {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return DeviceInfo{
+		LocationID:   d.LocationID,
+		LocationName: d.LocationName,
+		DeviceID:     d.DeviceID,
+		DeviceName:   d.DeviceName,
+		HasError:     d.HasError,
+		IsConnected:  d.IsConnected,
+	}
+}
+
+// setInfo updates the informations about the device.
+func (d *Device) setInfo(info DeviceInfo) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.LocationName = info.LocationName
+	d.DeviceName = info.DeviceName
+	d.HasError = info.HasError
+	d.IsConnected = info.IsConnected
+}
+
+// Attribute returns a copy of the last read value of attribute
+// attrID. false is returned if this value is not in the cache.
+func (d *Device) Attribute(attrID AttrID) (Value, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	pValue := d.Attributes[attrID]
+	if pValue == nil {
+		return Value{}, false
+	}
+	return *pValue, true
+}
+
+// AttributesSnapshot returns a copy of the cache of last read
+// attributes values.
+func (d *Device) AttributesSnapshot() map[AttrID]Value {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	attrs := make(map[AttrID]Value, len(d.Attributes))
+	for attrID, pValue := range d.Attributes {
+		if pValue != nil {
+			attrs[attrID] = *pValue
+		}
+	}
+	return attrs
+}
+
+func copyTimesheet(timesheet map[string]TimeslotSlice) map[string]TimeslotSlice {
+	ts := make(map[string]TimeslotSlice, len(timesheet))
+	for day, slots := range timesheet {
+		ts[day] = append(TimeslotSlice(nil), slots...)
+	}
+	return ts
+}
+
+// Timesheet returns a copy of the last read data of timesheet
+// id. false is returned if this timesheet is not in the cache.
+func (d *Device) Timesheet(id TimesheetID) (map[string]TimeslotSlice, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	timesheet, ok := d.Timesheets[id]
+	if !ok {
+		return nil, false
+	}
+	return copyTimesheet(timesheet), true
+}
+
+// TimesheetsSnapshot returns a copy of the cache of last read
+// timesheets data.
+func (d *Device) TimesheetsSnapshot() map[TimesheetID]map[string]TimeslotSlice {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	tss := make(map[TimesheetID]map[string]TimeslotSlice, len(d.Timesheets))
+	for id, timesheet := range d.Timesheets {
+		tss[id] = copyTimesheet(timesheet)
+	}
+	return tss
+}
+
+// ErrorsSnapshot returns a copy of the cache of last read errors.
+func (d *Device) ErrorsSnapshot() []ErrorHistoryEvent {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return append([]ErrorHistoryEvent(nil), d.Errors...)
 }
 
 // FormatAttributes displays informations about selected
-// attributes. Displays information about all known attributes when a
-// nil slice is passed.
+// attributes, described by the registry of d. Displays information
+// about all the attributes of the registry when a nil slice is
+// passed.
 func (d *Device) FormatAttributes(attrs []AttrID) string {
 	buf := bytes.NewBuffer(nil)
+	registry := d.Registry()
+	if attrs == nil {
+		attrs = registry.IDs()
+	}
 
 	pConcatFun := func(attrID AttrID, pValue *Value) {
-		pRef := AttributesRef[attrID]
+		pRef := registry.Ref(attrID)
 		if pRef == nil { //nolint: gocritic
-			buf.WriteString(
-				fmt.Sprintf("%d: %s@%s\n", attrID, pValue.Value, pValue.Time))
+			if pValue == nil {
+				buf.WriteString(fmt.Sprintf("%d: uninitialized\n", attrID))
+			} else {
+				buf.WriteString(
+					fmt.Sprintf("%d: %s@%s\n", attrID, pValue.Value, pValue.Time))
+			}
 		} else if pValue != nil {
 			humanValue, err := pRef.Type.Vitodata2HumanValue(pValue.Value)
 			if err != nil {
 				humanValue = fmt.Sprintf("unknown-value<%s>", pValue.Value)
+			} else if pRef.Unit != UnitNone {
+				humanValue += " " + string(pRef.Unit)
 			}
 			buf.WriteString(
 				fmt.Sprintf("%s: %s@%s (%s)\n",
@@ -53,6 +190,9 @@ func (d *Device) FormatAttributes(attrs []AttrID) string {
 		}
 	}
 
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	for _, attrID := range attrs {
 		pConcatFun(attrID, d.Attributes[attrID])
 	}
@@ -60,18 +200,6 @@ func (d *Device) FormatAttributes(attrs []AttrID) string {
 	return buf.String()
 }
 
-func (d *Device) buildBody(soapAction string, reqBody string) string {
-	return fmt.Sprintf(`<%s>
-<GeraetId>%d</GeraetId>
-<AnlageId>%d</AnlageId>
-%s
-</%[1]s>`, soapAction, d.DeviceID, d.LocationID, reqBody)
-}
-
-func (d *Device) sendRequest(v *Session, soapAction string, reqBody string, respBody HasResultHeader) error {
-	return v.sendRequest(soapAction, d.buildBody(soapAction, reqBody), respBody)
-}
-
 //
 // GetData
 //
@@ -95,27 +223,37 @@ func (r *GetDataResponse) ResultHeader() *ResultHeader {
 	return &r.GetDataResult.ResultHeader
 }
 
-func makeDatenpunktIDs(attrIDs []AttrID) string {
-	body := bytes.NewBufferString("<DatenpunktIds>")
-
-	for _, id := range attrIDs {
-		body.WriteString(fmt.Sprintf("<int>%d</int>", id))
-	}
-
-	body.WriteString("</DatenpunktIds>")
-
-	return body.String()
+type getDataRequest struct {
+	XMLName xml.Name `xml:"GetData"`
+	deviceRequest
+	IDs []AttrID `xml:"DatenpunktIds>int"`
 }
 
 // GetData launches the Vitotrol™ GetData request. Populates the
 // internal cache before returning (see Attributes field).
 func (d *Device) GetData(v *Session, attrIDs []AttrID) error {
+	return d.GetDataContext(context.Background(), v, attrIDs)
+}
+
+// GetDataContext is the same as GetData but allows to pass a context
+// controlling the cancellation and the deadline of the request.
+func (d *Device) GetDataContext(ctx context.Context, v *Session, attrIDs []AttrID) error {
 	var resp GetDataResponse
-	err := d.sendRequest(v, "GetData", makeDatenpunktIDs(attrIDs), &resp)
+	err := v.sendRequest(ctx, "GetData", &getDataRequest{
+		deviceRequest: d.deviceRequest(),
+		IDs:           attrIDs,
+	}, &resp)
 	if err != nil {
 		return err
 	}
 
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Attributes == nil {
+		d.Attributes = make(map[AttrID]*Value, len(resp.GetDataResult.Values))
+	}
+
 	// On met en cache
 	for _, respValue := range resp.GetDataResult.Values {
 		d.Attributes[AttrID(respValue.ID)] = &Value{
@@ -131,6 +269,13 @@ func (d *Device) GetData(v *Session, attrIDs []AttrID) error {
 // WriteData
 //
 
+type writeDataRequest struct {
+	XMLName xml.Name `xml:"WriteData"`
+	deviceRequest
+	ID    AttrID `xml:"DatapointId"`
+	Value string `xml:"Wert"`
+}
+
 // WriteDataResponse is a response to a WriteData request.
 type WriteDataResponse struct {
 	WriteDataResult struct {
@@ -147,16 +292,27 @@ func (r *WriteDataResponse) ResultHeader() *ResultHeader {
 // WriteData launches the Vitotrol™ WriteData request and returns the
 // "refresh ID" sent back by the server. Use WriteDataWait instead.
 func (d *Device) WriteData(v *Session, attrID AttrID, value string) (string, error) {
+	return d.WriteDataContext(context.Background(), v, attrID, value)
+}
+
+// WriteDataContext is the same as WriteData but allows to pass a
+// context controlling the cancellation and the deadline of the
+// request.
+func (d *Device) WriteDataContext(ctx context.Context, v *Session, attrID AttrID, value string) (string, error) {
 	var resp WriteDataResponse
-	err := d.sendRequest(v, "WriteData",
-		fmt.Sprintf("<DatapointId>%d</DatapointId><Wert>%s</Wert>", attrID, value),
-		&resp)
+	err := v.sendRequest(ctx, "WriteData", &writeDataRequest{
+		deviceRequest: d.deviceRequest(),
+		ID:            attrID,
+		Value:         value,
+	}, &resp)
 	if err != nil {
 		return "", err
 	}
 	return resp.WriteDataResult.RefreshID, nil
 }
 
+// Default polling of the WriteData operations. Session.Wait and
+// WithWait override it per session and per operation.
 var (
 	// WriteDataWaitDuration defines the duration to wait in
 	// WriteDataWait after the WriteData call before calling
@@ -177,26 +333,66 @@ var (
 //
 // If an error occurs during the WriteData call (synchronous one), a
 // nil channel is returned with an error.
+//
+// The channel is buffered, so it does not have to be read. Use
+// StartWriteData to follow the progress of the operation.
 func (d *Device) WriteDataWait(v *Session, attrID AttrID, value string) (<-chan error, error) {
-	refreshID, err := d.WriteData(v, attrID, value)
+	return d.WriteDataWaitContext(context.Background(), v, attrID, value)
+}
+
+// WriteDataWaitContext is the same as WriteDataWait but allows to
+// pass a context controlling the cancellation and the deadline of
+// the WriteData request as well as the following
+// RequestWriteStatus ones. When the context is done before the end
+// of the wait, its error is sent on the returned channel.
+func (d *Device) WriteDataWaitContext(ctx context.Context, v *Session, attrID AttrID, value string) (<-chan error, error) {
+	op, err := d.StartWriteData(ctx, v, attrID, value)
+	if err != nil {
+		return nil, err
+	}
+	return op.errChan(), nil
+}
+
+// StartWriteData launches the Vitotrol™ WriteData request and returns
+// the Operation following its completion. ctx controls the
+// cancellation and the deadline of the WriteData request as well as
+// the following RequestWriteStatus ones.
+//
+// If Session.VerifyWrites is true or WithVerify(true) is passed, the
+// written value is then read back, see WithVerify.
+func (d *Device) StartWriteData(ctx context.Context, v *Session, attrID AttrID, value string, options ...OperationOption) (*Operation, error) {
+	refreshID, err := d.WriteDataContext(ctx, v, attrID, value)
 	if err != nil {
 		return nil, err
 	}
 
-	ch := make(chan error)
+	op, ctx := newOperation(ctx, refreshID, options)
+	if v.verifyWrite(op) {
+		op.check = func(ctx context.Context) error {
+			return d.checkWrite(ctx, v, op, attrID, value)
+		}
+	}
 
-	go waitAsyncStatus(v, refreshID, ch, (*Session).RequestWriteStatus,
-		WriteDataWaitDuration,
-		WriteDataWaitMinDuration,
-		WriteDataWaitTimeout)
+	go waitAsyncStatus(ctx, v, op, asyncWriteStatus,
+		v.waitConfig(op, WaitConfig{
+			First:   WriteDataWaitDuration,
+			Min:     WriteDataWaitMinDuration,
+			Timeout: WriteDataWaitTimeout,
+		}))
 
-	return ch, nil
+	return op, nil
 }
 
 //
 // RefreshData
 //
 
+type refreshDataRequest struct {
+	XMLName xml.Name `xml:"RefreshData"`
+	deviceRequest
+	IDs []AttrID `xml:"DatenpunktIds>int"`
+}
+
 // RefreshDataResponse is a response to a RefreshData request.
 type RefreshDataResponse struct {
 	RefreshDataResult struct {
@@ -214,14 +410,27 @@ func (r *RefreshDataResponse) ResultHeader() *ResultHeader {
 // the "refresh ID" sent back by the server. Use RefreshDataWait
 // instead.
 func (d *Device) RefreshData(v *Session, attrIDs []AttrID) (string, error) {
+	return d.RefreshDataContext(context.Background(), v, attrIDs)
+}
+
+// RefreshDataContext is the same as RefreshData but allows to pass a
+// context controlling the cancellation and the deadline of the
+// request.
+func (d *Device) RefreshDataContext(ctx context.Context, v *Session, attrIDs []AttrID) (string, error) {
 	var resp RefreshDataResponse
-	err := d.sendRequest(v, "RefreshData", makeDatenpunktIDs(attrIDs), &resp)
+	err := v.sendRequest(ctx, "RefreshData", &refreshDataRequest{
+		deviceRequest: d.deviceRequest(),
+		IDs:           attrIDs,
+	}, &resp)
 	if err != nil {
 		return "", err
 	}
 	return resp.RefreshDataResult.RefreshID, nil
 }
 
+// Default polling of the RefreshData operations, as the ones
+// started by RefreshDataWait. Zero fields of Session.Wait or of
+// WithWait config take these values.
 var (
 	// RefreshDataWaitDuration defines the duration to wait in
 	// RefreshDataWait after the RefreshData call before calling
@@ -242,26 +451,58 @@ var (
 //
 // If an error occurs during the RefreshData call (synchronous one), a
 // nil channel is returned with an error.
+//
+// The channel is buffered, so it does not have to be read. Use
+// StartRefreshData to follow the progress of the operation.
 func (d *Device) RefreshDataWait(v *Session, attrIDs []AttrID) (<-chan error, error) {
-	refreshID, err := d.RefreshData(v, attrIDs)
+	return d.RefreshDataWaitContext(context.Background(), v, attrIDs)
+}
+
+// RefreshDataWaitContext is the same as RefreshDataWait but allows to
+// pass a context controlling the cancellation and the deadline of
+// the RefreshData request as well as the following
+// RequestRefreshStatus ones. When the context is done before the end
+// of the wait, its error is sent on the returned channel.
+func (d *Device) RefreshDataWaitContext(ctx context.Context, v *Session, attrIDs []AttrID) (<-chan error, error) {
+	op, err := d.StartRefreshData(ctx, v, attrIDs)
+	if err != nil {
+		return nil, err
+	}
+	return op.errChan(), nil
+}
+
+// StartRefreshData launches the Vitotrol™ RefreshData request and
+// returns the Operation following its completion. ctx controls the
+// cancellation and the deadline of the RefreshData request as well as
+// the following RequestRefreshStatus ones.
+func (d *Device) StartRefreshData(ctx context.Context, v *Session, attrIDs []AttrID, options ...OperationOption) (*Operation, error) {
+	refreshID, err := d.RefreshDataContext(ctx, v, attrIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	ch := make(chan error)
+	op, ctx := newOperation(ctx, refreshID, options)
 
-	go waitAsyncStatus(v, refreshID, ch, (*Session).RequestRefreshStatus,
-		RefreshDataWaitDuration,
-		RefreshDataWaitMinDuration,
-		RefreshDataWaitTimeout)
+	go waitAsyncStatus(ctx, v, op, asyncRefreshStatus,
+		v.waitConfig(op, WaitConfig{
+			First:   RefreshDataWaitDuration,
+			Min:     RefreshDataWaitMinDuration,
+			Timeout: RefreshDataWaitTimeout,
+		}))
 
-	return ch, nil
+	return op, nil
 }
 
 //
 // GetErrorHistory
 //
 
+type getErrorHistoryRequest struct {
+	XMLName xml.Name `xml:"GetErrorHistory"`
+	deviceRequest
+	Culture string `xml:"Culture"`
+}
+
 // ErrorHistoryEvent represents a timestamped history event generally
 // found in a GetErrorHistoryResponse.
 type ErrorHistoryEvent struct {
@@ -296,13 +537,25 @@ func (r *GetErrorHistoryResponse) ResultHeader() *ResultHeader {
 // request. Populates the internal cache before returning (see Errors
 // field).
 func (d *Device) GetErrorHistory(v *Session) error {
+	return d.GetErrorHistoryContext(context.Background(), v)
+}
+
+// GetErrorHistoryContext is the same as GetErrorHistory but allows to
+// pass a context controlling the cancellation and the deadline of
+// the request.
+func (d *Device) GetErrorHistoryContext(ctx context.Context, v *Session) error {
 	var resp GetErrorHistoryResponse
-	err := d.sendRequest(v, "GetErrorHistory", "<Culture>fr-fr</Culture>", &resp)
+	err := v.sendRequest(ctx, "GetErrorHistory", &getErrorHistoryRequest{
+		deviceRequest: d.deviceRequest(),
+		Culture:       "fr-fr",
+	}, &resp)
 	if err != nil {
 		return err
 	}
 
+	d.mu.Lock()
 	d.Errors = resp.GetErrorHistoryResult.Events
+	d.mu.Unlock()
 	return nil
 }
 
@@ -310,6 +563,12 @@ func (d *Device) GetErrorHistory(v *Session) error {
 // GetTimesheetData
 //
 
+type getTimesheetDataRequest struct {
+	XMLName xml.Name `xml:"GetTimesheetData"`
+	deviceRequest
+	ID TimesheetID `xml:"DatenpunktId"`
+}
+
 type daySlot struct {
 	Day  string `xml:"Wochentag"`
 	From uint16 `xml:"ZeitVon"`
@@ -334,9 +593,18 @@ func (r *GetTimesheetDataResponse) ResultHeader() *ResultHeader {
 // request. Populates the internal cache before returning (see
 // Timesheets field).
 func (d *Device) GetTimesheetData(v *Session, id TimesheetID) error {
+	return d.GetTimesheetDataContext(context.Background(), v, id)
+}
+
+// GetTimesheetDataContext is the same as GetTimesheetData but allows
+// to pass a context controlling the cancellation and the deadline of
+// the request.
+func (d *Device) GetTimesheetDataContext(ctx context.Context, v *Session, id TimesheetID) error {
 	var resp GetTimesheetDataResponse
-	err := d.sendRequest(v, "GetTimesheetData",
-		fmt.Sprintf("<DatenpunktId>%d</DatenpunktId>", id), &resp)
+	err := v.sendRequest(ctx, "GetTimesheetData", &getTimesheetDataRequest{
+		deviceRequest: d.deviceRequest(),
+		ID:            id,
+	}, &resp)
 	if err != nil {
 		return err
 	}
@@ -356,7 +624,12 @@ func (d *Device) GetTimesheetData(v *Session, id TimesheetID) error {
 		sort.Sort(daySlots)
 	}
 
+	d.mu.Lock()
+	if d.Timesheets == nil {
+		d.Timesheets = map[TimesheetID]map[string]TimeslotSlice{}
+	}
 	d.Timesheets[id] = timesheet
+	d.mu.Unlock()
 
 	return nil
 }
@@ -365,6 +638,32 @@ func (d *Device) GetTimesheetData(v *Session, id TimesheetID) error {
 // WriteTimesheetData
 //
 
+type writeTimesheetSlot struct {
+	Day      string `xml:"Wochentag"`
+	From     string `xml:"ZeitVon"`
+	To       string `xml:"ZeitBis"`
+	Value    int    `xml:"Wert"`
+	Position int    `xml:"Position"`
+}
+
+// Oddly, WriteTimesheetData has a nested layer SchaltsatzData
+// before GeraetId and AnlageId fields.
+type writeTimesheetDataRequest struct {
+	XMLName xml.Name `xml:"WriteTimesheetData"`
+	Data    struct {
+		deviceRequest
+		Type  int         `xml:"SchaltzeitTyp"`
+		ID    TimesheetID `xml:"DatenpunktId"`
+		Slots struct {
+			Slots []writeTimesheetSlot `xml:"Schaltzeit"`
+		} `xml:"Schaltzeiten"`
+	} `xml:"SchaltsatzData"`
+}
+
+func (r *writeTimesheetDataRequest) device() deviceRequest {
+	return r.Data.deviceRequest
+}
+
 // WriteTimesheetDataResponse is a response to a WriteTimesheetData request.
 type WriteTimesheetDataResponse struct {
 	WriteTimesheetDataResult struct {
@@ -401,19 +700,24 @@ var timesheetDaysIdx = func() map[string]int {
 // not populate the internal cache before returning (Timesheets
 // field), use WriteTimesheetDataWait instead.
 func (d *Device) WriteTimesheetData(v *Session, id TimesheetID, data map[string]TimeslotSlice) (string, error) {
-	buf := bytes.NewBufferString(
-		`<SchaltzeitTyp>1</SchaltzeitTyp>` +
-			`<DatenpunktId>`)
-	buf.WriteString(strconv.Itoa(int(id)))
-	buf.WriteString(`</DatenpunktId>` +
-		`<Schaltzeiten>`)
+	return d.WriteTimesheetDataContext(context.Background(), v, id, data)
+}
+
+// WriteTimesheetDataContext is the same as WriteTimesheetData but
+// allows to pass a context controlling the cancellation and the
+// deadline of the request.
+func (d *Device) WriteTimesheetDataContext(ctx context.Context, v *Session, id TimesheetID, data map[string]TimeslotSlice) (string, error) {
+	var req writeTimesheetDataRequest
+	req.Data.deviceRequest = d.deviceRequest()
+	req.Data.Type = 1
+	req.Data.ID = id
 
 	dayDone := make(map[string]bool, 7)
 	for _, day := range timesheetDays {
 		dayDone[day] = false
 	}
 
-	preDays := make(map[string]*bytes.Buffer, 7)
+	preDays := make(map[string][]writeTimesheetSlot, 7)
 	for day, daySlots := range data {
 		day = strings.ToUpper(day)
 
@@ -453,48 +757,36 @@ func (d *Device) WriteTimesheetData(v *Session, id TimesheetID, data map[string]
 			}
 			dayDone[day] = true
 
-			tmpBuf := bytes.NewBuffer(nil)
-			preDays[day] = tmpBuf
-
+			slots := make([]writeTimesheetSlot, len(daySlots))
 			for idxSlot, slot := range daySlots {
-				tmpBuf.WriteString(fmt.Sprintf(
-					`<Schaltzeit>`+
-						`<Wochentag>%s</Wochentag>`+
-						`<ZeitVon>%04d</ZeitVon>`+
-						`<ZeitBis>%04d</ZeitBis>`+
-						`<Wert>1</Wert>`+
-						`<Position>%d</Position>`+
-						`</Schaltzeit>`,
-					day, slot.From, slot.To, idxSlot))
+				slots[idxSlot] = writeTimesheetSlot{
+					Day:      day,
+					From:     fmt.Sprintf("%04d", slot.From),
+					To:       fmt.Sprintf("%04d", slot.To),
+					Value:    1,
+					Position: idxSlot,
+				}
 			}
+			preDays[day] = slots
 		}
 	}
 
 	// Write sorted days
 	for _, day := range timesheetDays {
-		tmpBuf := preDays[day]
-		if tmpBuf != nil {
-			buf.Write(tmpBuf.Bytes())
-		}
+		req.Data.Slots.Slots = append(req.Data.Slots.Slots, preDays[day]...)
 	}
 
-	buf.WriteString(`</Schaltzeiten>`)
-
-	// Oddly, WriteTimesheetData has a nested layer SchaltsatzData
-	// before GeraetId and AnlageId fields, so use the
-	// Session.sendRequest method instead of Device.sendRequest
 	var resp WriteTimesheetDataResponse
-	err := v.sendRequest("WriteTimesheetData",
-		`<WriteTimesheetData>`+
-			d.buildBody("SchaltsatzData", buf.String())+
-			`</WriteTimesheetData>`,
-		&resp)
+	err := v.sendRequest(ctx, "WriteTimesheetData", &req, &resp)
 	if err != nil {
 		return "", err
 	}
 	return resp.WriteTimesheetDataResult.RefreshID, nil
 }
 
+// Default polling of the WriteTimesheetData operations, as the ones
+// started by WriteTimesheetDataWait or StartWriteTimesheetData. It
+// can be changed using Session.Wait or WithWait.
 var (
 	// WriteTimesheetDataWaitDuration defines the duration to wait in
 	// WriteTimesheetDataWait after the WriteTimesheetData call before
@@ -517,20 +809,47 @@ var (
 //
 // If an error occurs during the WriteTimesheetData call (synchronous
 // one), a nil channel is returned with an error.
+//
+// The channel is buffered, so it does not have to be read. Use
+// StartWriteTimesheetData to follow the progress of the operation.
 func (d *Device) WriteTimesheetDataWait(v *Session, id TimesheetID, data map[string]TimeslotSlice) (<-chan error, error) {
-	refreshID, err := d.WriteTimesheetData(v, id, data)
+	return d.WriteTimesheetDataWaitContext(context.Background(), v, id, data)
+}
+
+// WriteTimesheetDataWaitContext is the same as WriteTimesheetDataWait
+// but allows to pass a context controlling the cancellation and the
+// deadline of the WriteTimesheetData request as well as the
+// following RequestWriteStatus ones. When the context is done before
+// the end of the wait, its error is sent on the returned channel.
+func (d *Device) WriteTimesheetDataWaitContext(ctx context.Context, v *Session, id TimesheetID, data map[string]TimeslotSlice) (<-chan error, error) {
+	op, err := d.StartWriteTimesheetData(ctx, v, id, data)
+	if err != nil {
+		return nil, err
+	}
+	return op.errChan(), nil
+}
+
+// StartWriteTimesheetData launches the Vitotrol™ WriteTimesheetData
+// request and returns the Operation following its completion. ctx
+// controls the cancellation and the deadline of the
+// WriteTimesheetData request as well as the following
+// RequestWriteStatus ones.
+func (d *Device) StartWriteTimesheetData(ctx context.Context, v *Session, id TimesheetID, data map[string]TimeslotSlice, options ...OperationOption) (*Operation, error) {
+	refreshID, err := d.WriteTimesheetDataContext(ctx, v, id, data)
 	if err != nil {
 		return nil, err
 	}
 
-	ch := make(chan error)
+	op, ctx := newOperation(ctx, refreshID, options)
 
-	go waitAsyncStatus(v, refreshID, ch, (*Session).RequestWriteStatus,
-		WriteTimesheetDataWaitDuration,
-		WriteTimesheetDataWaitMinDuration,
-		WriteTimesheetDataWaitTimeout)
+	go waitAsyncStatus(ctx, v, op, asyncWriteStatus,
+		v.waitConfig(op, WaitConfig{
+			First:   WriteTimesheetDataWaitDuration,
+			Min:     WriteTimesheetDataWaitMinDuration,
+			Timeout: WriteTimesheetDataWaitTimeout,
+		}))
 
-	return ch, nil
+	return op, nil
 }
 
 // ErrTimeout is the error returned by WriteDataWait,
@@ -538,54 +857,65 @@ func (d *Device) WriteTimesheetDataWait(v *Session, id TimesheetID, data map[str
 // response wait times out.
 var ErrTimeout = errors.New("Timeout")
 
-func waitAsyncStatus(v *Session, refreshID string, ch chan error,
-	requestStatus func(*Session, string) (int, error),
-	waitFirstDuration, waitminDuration, timeout time.Duration) {
-	start := time.Now()
+func waitAsyncStatus(ctx context.Context, v *Session, op *Operation,
+	requestStatus func(context.Context, *Session, string) (AsyncStatus, error),
+	config WaitConfig) {
+	clock := v.clock()
+	start := clock.Now()
+	logger := v.logger()
 	// Waiting availability of data, yes *8* seconds the first time :(
-	for wait := waitFirstDuration; true; {
-		time.Sleep(wait)
+	for wait := config.First; true; {
+		if err := sleepContext(ctx, clock, wait); err != nil {
+			op.finish(nil, err)
+			break
+		}
 
-		status, err := requestStatus(v, refreshID)
+		status, err := requestStatus(ctx, v, op.ID())
 		if err != nil {
-			ch <- err
+			op.finish(nil, err)
 			break
 		}
 
-		// End when status == 4 || status == 9
-		// Setting DateTime returns status 9 on success
-		if status >= 4 {
-			if status != 4 && status != 9 {
-				ch <- fmt.Errorf("Unexpected status %d", status)
+		if status.IsFinal() {
+			if !status.IsSuccess() {
+				err = &UnexpectedStatusError{Status: status}
+			} else if op.check != nil {
+				err = op.check(ctx)
 			}
+			op.finish(status, err)
 			break
 		}
 
-		if time.Until(start) >= timeout {
-			ch <- ErrTimeout
+		op.progress(status)
+
+		if config.timedOut(clock.Now().Sub(start)) {
+			op.finish(nil, ErrTimeout)
 			break
 		}
 
-		wait /= 4
-		if wait < waitminDuration {
-			wait = waitminDuration
-		}
+		wait = config.next(wait)
 
-		if (status != 1 && status != 3) || v.Debug {
-			log.Printf("waitAsyncStatus(%s): status %d, wait %d secs...\n",
-				refreshID, status, wait/time.Second)
+		level := slog.LevelDebug
+		if !isPendingStatus(status) {
+			level = slog.LevelInfo
 		}
+		logger.Log(ctx, level, "waiting for asynchronous status",
+			"refresh_id", op.ID(), "status", status, "wait", wait)
 	}
-	if v.Debug {
-		log.Printf("waitAsyncStatus(%s) done in %s", refreshID, time.Since(start))
-	}
-	close(ch)
+	logger.LogAttrs(ctx, slog.LevelDebug, "asynchronous operation done",
+		slog.String("refresh_id", op.ID()),
+		slog.Duration("duration", clock.Now().Sub(start)))
 }
 
 //
 // GetTypeInfo
 //
 
+type getTypeInfoRequest struct {
+	XMLName xml.Name `xml:"GetTypeInfo"`
+	deviceRequest
+}
+
 // AttributeInfo defines an attribute.
 type AttributeInfo struct {
 	AttributeInfoBase
@@ -628,8 +958,16 @@ func (r *GetTypeInfoResponse) ResultHeader() *ResultHeader {
 
 // GetTypeInfo launches the Vitotrol™ GetTypeInfo request.
 func (d *Device) GetTypeInfo(v *Session) ([]*AttributeInfo, error) {
+	return d.GetTypeInfoContext(context.Background(), v)
+}
+
+// GetTypeInfoContext is the same as GetTypeInfo but allows to pass a
+// context controlling the cancellation and the deadline of the
+// request.
+func (d *Device) GetTypeInfoContext(ctx context.Context, v *Session) ([]*AttributeInfo, error) {
 	var resp GetTypeInfoResponse
-	err := d.sendRequest(v, "GetTypeInfo", "", &resp)
+	err := v.sendRequest(ctx, "GetTypeInfo",
+		&getTypeInfoRequest{deviceRequest: d.deviceRequest()}, &resp)
 	if err != nil {
 		return nil, err
 	}
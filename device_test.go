@@ -2,6 +2,8 @@ package vitotrol
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 
 	td "github.com/maxatome/go-testdeep"
@@ -51,23 +53,23 @@ func TestFormatAttributes(tt *testing.T) {
 		},
 	}
 
+	t.CmpDeeply(pDevice.FormatAttributes([]AttrID{9998}), "9998: uninitialized\n")
+
 	t.CmpDeeply(
 		pDevice.FormatAttributes(
 			[]AttrID{NoAttr, BurnerState, IndoorTemp, OutdoorTemp}),
 		fmt.Sprintf("%d: unknown-attr@%s\n", NoAttr, testTime)+
 			fmt.Sprintf("BurnerState: unknown-value<invalid-value>@%s (%s)\n",
 				testTime, AttributesRef[BurnerState].Doc)+
-			fmt.Sprintf("IndoorTemp: 22@%s (%s)\n",
+			fmt.Sprintf("IndoorTemp: 22 °C@%s (%s)\n",
 				testTime, AttributesRef[IndoorTemp].Doc)+
 			fmt.Sprintf("OutdoorTemp: uninitialized (%s)\n",
 				AttributesRef[OutdoorTemp].Doc))
-}
-
-func TestMakeDatenpunktIDs(tt *testing.T) {
-	t := td.NewT(tt)
 
-	t.CmpDeeply(makeDatenpunktIDs([]AttrID{11, 22}),
-		`<DatenpunktIds><int>11</int><int>22</int></DatenpunktIds>`)
+	// All the attributes of the registry
+	all := pDevice.FormatAttributes(nil)
+	t.Cmp(strings.Count(all, "\n"), len(pDevice.Registry().IDs()))
+	t.Cmp(all, td.Contains(fmt.Sprintf("IndoorTemp: 22 °C@%s", testTime)))
 }
 
 type requestDeviceCommon struct {
@@ -97,7 +99,7 @@ func testSendRequestDeviceAny(t *td.T,
 
 	return testSendRequestAny(t,
 		func(v *Session) bool {
-			v.Devices = []Device{
+			v.Devices = []*Device{
 				{
 					DeviceID:   testDeviceID,
 					LocationID: testLocationID,
@@ -105,7 +107,7 @@ func testSendRequestDeviceAny(t *td.T,
 					Timesheets: map[TimesheetID]map[string]TimeslotSlice{},
 				},
 			}
-			return sendReq(v, &v.Devices[0])
+			return sendReq(v, v.Devices[0])
 		},
 		soapAction, expectedRequest,
 		intoDeviceResponse(soapAction, serverResponse),
@@ -825,3 +827,89 @@ func TestGetTypeInfo(tt *testing.T) {
 		`<bad XML>`,
 		"GetTypeInfo with error")
 }
+
+func TestDeviceSnapshots(tt *testing.T) {
+	t := td.NewT(tt)
+
+	d := &Device{
+		Attributes: map[AttrID]*Value{
+			IndoorTemp:  {Value: "22", Time: testTime},
+			OutdoorTemp: nil,
+		},
+		Timesheets: map[TimesheetID]map[string]TimeslotSlice{
+			HeatingTimesheet: {"mon": {{From: 600, To: 2200}}},
+		},
+		Errors: []ErrorHistoryEvent{{Error: "AB", Time: testTime}},
+	}
+
+	value, ok := d.Attribute(IndoorTemp)
+	t.True(ok)
+	t.CmpDeeply(value, Value{Value: "22", Time: testTime})
+	_, ok = d.Attribute(OutdoorTemp)
+	t.False(ok)
+	_, ok = d.Attribute(BoilerTemp)
+	t.False(ok)
+
+	attrs := d.AttributesSnapshot()
+	t.CmpDeeply(attrs, map[AttrID]Value{IndoorTemp: {Value: "22", Time: testTime}})
+	attrs[IndoorTemp] = Value{Value: "0"}
+	t.CmpDeeply(d.Attributes[IndoorTemp].Value, "22")
+
+	ts, ok := d.Timesheet(HeatingTimesheet)
+	t.True(ok)
+	t.CmpDeeply(ts, map[string]TimeslotSlice{"mon": {{From: 600, To: 2200}}})
+	ts["mon"][0].From = 0
+	t.CmpDeeply(d.Timesheets[HeatingTimesheet]["mon"][0].From, uint16(600))
+	_, ok = d.Timesheet(HotWaterTimesheet)
+	t.False(ok)
+
+	tss := d.TimesheetsSnapshot()
+	t.CmpDeeply(tss, d.Timesheets)
+	tss[HeatingTimesheet]["mon"][0].To = 0
+	t.CmpDeeply(d.Timesheets[HeatingTimesheet]["mon"][0].To, uint16(2200))
+
+	errs := d.ErrorsSnapshot()
+	t.CmpDeeply(errs, d.Errors)
+	errs[0].Error = "XX"
+	t.CmpDeeply(d.Errors[0].Error, "AB")
+}
+
+func TestDeviceConcurrency(tt *testing.T) {
+	t := td.NewT(tt)
+
+	testSendRequestDeviceAny(t,
+		func(v *Session, d *Device) bool {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					t.CmpNoError(d.GetData(v, []AttrID{11}))
+				}()
+				go func() {
+					defer wg.Done()
+					d.AttributesSnapshot()
+					d.FormatAttributes([]AttrID{11})
+					v.CookiesSnapshot()
+				}()
+			}
+			wg.Wait()
+
+			value, ok := d.Attribute(11)
+			return t.True(ok) && t.CmpDeeply(value.Value, "value11")
+		},
+		"GetData",
+		&struct {
+			IDs []int `xml:"Body>GetData>DatenpunktIds>int"`
+		}{IDs: []int{11}},
+		`<Ergebnis>0</Ergebnis>
+<ErgebnisText>Kein Fehler</ErgebnisText>
+<DatenwerteListe>
+  <WerteListe>
+    <DatenpunktId>11</DatenpunktId>
+    <Wert>value11</Wert>
+    <Zeitstempel>`+testTimeStr+`</Zeitstempel>
+  </WerteListe>
+</DatenwerteListe>`,
+		"GetData concurrency")
+}
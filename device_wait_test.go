@@ -1,6 +1,7 @@
 package vitotrol
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -58,7 +59,7 @@ func testSendRequestAnyMulti(t *td.T,
 
 	MainURL = ts.URL
 	v := &Session{
-		Devices: []Device{
+		Devices: []*Device{
 			{
 				DeviceID:   testDeviceID,
 				LocationID: testLocationID,
@@ -67,7 +68,7 @@ func testSendRequestAnyMulti(t *td.T,
 			},
 		},
 	}
-	return sendReqs(v, &v.Devices[0])
+	return sendReqs(v, v.Devices[0])
 }
 
 //
@@ -241,3 +242,40 @@ func TestRefreshDataWait(tt *testing.T) {
 		},
 		"RefreshDataWait, error during RequestRefreshStatus")
 }
+
+func TestWaitContext(tt *testing.T) {
+	t := td.NewT(tt)
+
+	testSendRequestAnyMulti(t,
+		func(v *Session, d *Device) bool {
+			v.Wait = &WaitConfig{First: time.Hour}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			ch, err := d.RefreshDataWaitContext(ctx, v, refreshDataTestIDs)
+			if !t.CmpNoError(err) {
+				cancel()
+				return false
+			}
+			cancel()
+
+			timeoutTicker := time.NewTicker(100 * time.Millisecond)
+			defer timeoutTicker.Stop()
+
+			select {
+			case err = <-ch:
+				return t.CmpErrorIs(err, context.Canceled)
+			case <-timeoutTicker.C:
+				t.Error("TIMEOUT!")
+				return false
+			}
+		},
+		map[string]*testAction{
+			"RefreshData": {
+				expectedRequest: refreshDataTest.expectedRequest,
+				serverResponse: intoDeviceResponse(
+					"RefreshData", refreshDataTest.serverResponse),
+			},
+			"RequestRefreshStatus": &requestRefreshStatusTest,
+		},
+		"RefreshDataWaitContext canceled")
+}
@@ -0,0 +1,139 @@
+package vitotrol
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Vitodata™ types of GetTypeInfo datapoints not listed in TypeNames.
+const (
+	typeInfoEnum        = "ENUM"
+	typeInfoCircuitTime = "CircuitTime" // timesheets
+)
+
+// DiscoveredAttributes is the result of Device.DiscoverAttributes.
+type DiscoveredAttributes struct {
+	// Attributes contains the reference of each datapoint, as
+	// registered in the registry of the device.
+	Attributes map[AttrID]*AttrRef
+	// Timesheets contains the reference of each CircuitTime datapoint,
+	// as registered in the registry of the device.
+	Timesheets map[TimesheetID]*TimesheetRef
+	// Unsupported lists the datapoints whose type is not supported.
+	Unsupported []*AttributeInfo
+}
+
+// DiscoverAttributes launches the Vitotrol™ GetTypeInfo request and
+// registers in the registry of d (see Device.Registry) the
+// datapoints it does not know yet:
+//   - ENUM ones are typed using NewEnum with the values sent by the
+//     server;
+//   - CircuitTime ones are registered as timesheets;
+//   - the other ones are typed using TypeNames, or are reported as
+//     unsupported.
+//
+// Discovered datapoints are named "AttributeName-0xNNNN", and their
+// access is derived from the Readable and Writable fields.
+// The range of numeric datapoints is set from their MinValue and
+// MaxValue fields. Datapoints already known by the registry, as the
+// built-in ones, are left untouched, except their range, replaced by
+// the one sent by the server, if any.
+func (d *Device) DiscoverAttributes(ctx context.Context, v *Session) (*DiscoveredAttributes, error) {
+	infos, err := d.GetTypeInfoContext(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := d.Registry()
+	discovered := &DiscoveredAttributes{
+		Attributes: make(map[AttrID]*AttrRef, len(infos)),
+		Timesheets: map[TimesheetID]*TimesheetRef{},
+	}
+
+	for _, pInfo := range infos {
+		name := fmt.Sprintf("%s-0x%04x", pInfo.AttributeName, pInfo.AttributeID)
+
+		if pInfo.AttributeType == typeInfoCircuitTime {
+			timesheetID := TimesheetID(pInfo.AttributeID)
+			if registry.Timesheet(timesheetID) == nil {
+				registry.AddTimesheet(timesheetID, TimesheetRef{
+					Name: name,
+					Doc:  pInfo.AttributeName,
+				})
+			}
+			discovered.Timesheets[timesheetID] = registry.Timesheet(timesheetID)
+			continue
+		}
+
+		if pRef := registry.Ref(pInfo.AttributeID); pRef == nil {
+			ref, ok := pInfo.attrRef(name)
+			if !ok {
+				v.logger().LogAttrs(ctx, slog.LevelWarn, "unsupported datapoint type",
+					slog.String("type", pInfo.AttributeType),
+					slog.String("name", name))
+				discovered.Unsupported = append(discovered.Unsupported, pInfo)
+				continue
+			}
+			registry.Add(pInfo.AttributeID, ref)
+		} else if learned := pInfo.attrRange(pRef.Type); learned != nil {
+			ref := *pRef
+			if ref.Range != nil {
+				learned.Step = ref.Range.Step
+			}
+			ref.Range = learned
+			registry.Add(pInfo.AttributeID, ref)
+		}
+		discovered.Attributes[pInfo.AttributeID] = registry.Ref(pInfo.AttributeID)
+	}
+
+	return discovered, nil
+}
+
+// attrRef returns the reference named name of the attribute described
+// by i. false is returned if its type is not supported.
+func (i *AttributeInfo) attrRef(name string) (AttrRef, bool) {
+	ref := AttrRef{
+		Name: name,
+		Doc:  i.AttributeName,
+	}
+
+	if i.AttributeType == typeInfoEnum {
+		var maxIdx uint32
+		for idx := range i.EnumValues {
+			if idx > maxIdx {
+				maxIdx = idx
+			}
+		}
+		enumValues := make([]string, maxIdx+1)
+		for idx, value := range i.EnumValues {
+			enumValues[idx] = value
+		}
+		ref.Type = NewEnum(enumValues)
+	} else {
+		ref.Type = TypeNames[i.AttributeType]
+		if ref.Type == nil {
+			return AttrRef{}, false
+		}
+	}
+
+	ref.Range = i.attrRange(ref.Type)
+
+	if i.Readable {
+		ref.Access = ReadOnly
+	}
+	if i.Writable {
+		ref.Access |= WriteOnly
+	}
+	return ref, true
+}
+
+// attrRange returns the range described by the MinValue and MaxValue
+// fields of i, if the attribute is numeric, or nil.
+func (i *AttributeInfo) attrRange(typ VitodataType) *AttrRange {
+	if typ != TypeDouble && typ != TypeInteger {
+		return nil
+	}
+	r, _ := parseRange(i.MinValue, i.MaxValue)
+	return r
+}
@@ -0,0 +1,127 @@
+package vitotrol_test
+
+import (
+	"context"
+	"testing"
+
+	td "github.com/maxatome/go-testdeep"
+
+	"github.com/maxatome/go-vitotrol"
+	"github.com/maxatome/go-vitotrol/vitotroltest"
+)
+
+func TestDiscoverAttributes(tt *testing.T) {
+	t := td.NewT(tt)
+
+	typeInfo := func(id vitotrol.AttrID, name, typ string, readable, writable bool) *vitotrol.AttributeInfo {
+		return &vitotrol.AttributeInfo{
+			AttributeID: id,
+			AttributeInfoBase: vitotrol.AttributeInfoBase{
+				AttributeName: name,
+				AttributeType: typ,
+				Readable:      readable,
+				Writable:      writable,
+			},
+		}
+	}
+	withRange := func(info *vitotrol.AttributeInfo, min, max string) *vitotrol.AttributeInfo {
+		info.MinValue, info.MaxValue = min, max
+		return info
+	}
+	enum := typeInfo(0x2346, "Mode", "ENUM", true, true)
+	enum.EnumValues = map[uint32]string{0: "off", 1: "eco", 3: "comfort"}
+
+	fake := vitotroltest.New()
+	dev := fake.AddAccount("pipo", "bingo").
+		AddLocation(12, "Home").
+		AddDevice(34, "Boiler")
+	v, d := vitotroltest.NewSessionWithDevice(t, fake, "pipo", "bingo", dev)
+	dev.SetTypeInfo([]*vitotrol.AttributeInfo{
+		typeInfo(vitotrol.IndoorTemp, "Raumtemperatur", "Double", true, false),
+		withRange(typeInfo(0x2345, "Vorlauftemperatur", "Double", true, true), "-20", "90,5"),
+		withRange(typeInfo(vitotrol.HotWaterSetpointTemp, "Warmwassersollwert", "Double", true, true), "10", "70"),
+		enum,
+		typeInfo(0x2347, "Sollwert", "Integer", false, true),
+		typeInfo(vitotrol.AttrID(vitotrol.HeatingTimesheet), "Zeitprogramm", "CircuitTime", true, true),
+		typeInfo(0x2348, "Zeitprogramm Pumpe", "CircuitTime", true, true),
+		typeInfo(0x2349, "Bitfeld", "Bitfield", true, false),
+	})
+	registry := d.Registry()
+
+	discovered, err := d.DiscoverAttributes(context.Background(), v)
+	if !t.CmpNoError(err) {
+		return
+	}
+
+	t.Cmp(discovered, &vitotrol.DiscoveredAttributes{
+		Attributes: map[vitotrol.AttrID]*vitotrol.AttrRef{
+			vitotrol.IndoorTemp: vitotrol.AttributesRef[vitotrol.IndoorTemp],
+			0x2345: {
+				Type:   vitotrol.TypeDouble,
+				Access: vitotrol.ReadWrite,
+				Name:   "Vorlauftemperatur-0x2345",
+				Doc:    "Vorlauftemperatur",
+				Range:  &vitotrol.AttrRange{Min: -20, Max: 90.5},
+			},
+			vitotrol.HotWaterSetpointTemp: {
+				Type:   vitotrol.TypeDouble,
+				Access: vitotrol.ReadWrite,
+				Name:   "HotWaterSetpointTemp",
+				Doc:    vitotrol.AttributesRef[vitotrol.HotWaterSetpointTemp].Doc,
+				Range:  &vitotrol.AttrRange{Min: 10, Max: 70}, // learned
+				Unit:   vitotrol.UnitCelsius,
+			},
+			0x2346: {
+				Type:   vitotrol.NewEnum([]string{"off", "eco", "", "comfort"}),
+				Access: vitotrol.ReadWrite,
+				Name:   "Mode-0x2346",
+				Doc:    "Mode",
+			},
+			0x2347: {
+				Type:   vitotrol.TypeInteger,
+				Access: vitotrol.WriteOnly,
+				Name:   "Sollwert-0x2347",
+				Doc:    "Sollwert",
+			},
+		},
+		Timesheets: map[vitotrol.TimesheetID]*vitotrol.TimesheetRef{
+			vitotrol.HeatingTimesheet: vitotrol.TimesheetsRef[vitotrol.HeatingTimesheet],
+			0x2348: {
+				Name: "Zeitprogramm Pumpe-0x2348",
+				Doc:  "Zeitprogramm Pumpe",
+			},
+		},
+		Unsupported: []*vitotrol.AttributeInfo{
+			typeInfo(0x2349, "Bitfeld", "Bitfield", true, false),
+		},
+	})
+
+	// Registered in the device registry
+	t.Shallow(registry.Ref(0x2345), discovered.Attributes[0x2345])
+	id, ok := registry.ID("Mode-0x2346")
+	t.True(ok)
+	t.Cmp(id, vitotrol.AttrID(0x2346))
+	t.Shallow(registry.Timesheet(0x2348), discovered.Timesheets[0x2348])
+	t.Nil(registry.Ref(0x2349))
+
+	// Enum values are usable
+	value, err := registry.Ref(0x2346).Type.Vitodata2HumanValue("3")
+	t.CmpNoError(err)
+	t.Cmp(value, "comfort")
+
+	// Learned ranges are enforced by WriteValue
+	_, err = d.WriteValue(context.Background(), v, 0x2345, "91")
+	t.String(err, "Value 91 of Vorlauftemperatur-0x2345 is out of range [-20, 90.5]")
+	op, err := d.WriteValue(context.Background(), v, vitotrol.HotWaterSetpointTemp, "65",
+		vitotrol.WithWait(vitotrol.WaitConfig{First: -1, Min: -1}))
+	if t.CmpNoError(err) {
+		t.CmpNoError(op.Wait(context.Background()))
+		value, _ := dev.Value(vitotrol.HotWaterSetpointTemp)
+		t.Cmp(value, "65")
+	}
+
+	// Not in the built-in catalog, nor in other devices registries
+	t.Cmp(vitotrol.AttributesRef, td.Not(td.ContainsKey(vitotrol.AttrID(0x2345))))
+	other := &vitotrol.Device{LocationID: 12, DeviceID: 34}
+	t.Nil(other.Registry().Ref(0x2345))
+}
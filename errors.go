@@ -0,0 +1,118 @@
+package vitotrol
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Errors that can be matched using errors.Is against errors returned
+// by Session and Device methods. *ResultHeader errors are mapped to
+// them using Session.ResultErrors, *HTTPError ones using their
+// status code.
+var (
+	// ErrInvalidCredentials is returned when the login or the
+	// password is rejected by the Vitotrol™ server.
+	ErrInvalidCredentials = errors.New("Invalid credentials")
+	// ErrSessionExpired is returned when the session is not (or no
+	// longer) logged in.
+	ErrSessionExpired = errors.New("Session expired")
+	// ErrDeviceOffline is returned when the device cannot be reached
+	// by the Vitotrol™ server.
+	ErrDeviceOffline = errors.New("Device offline")
+	// ErrUnknownDatapoint is returned when an attribute or a timesheet
+	// is not known by the device.
+	ErrUnknownDatapoint = errors.New("Unknown datapoint")
+	// ErrServerBusy is returned when the Vitotrol™ server is
+	// temporarily unable to handle the request.
+	ErrServerBusy = errors.New("Server busy")
+)
+
+// HTTPError is returned when the Vitotrol™ server answers with an
+// HTTP status different from 200.
+type HTTPError struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Error returns the HTTP error as a string.
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP error: [status=%d] %s", e.StatusCode, e.Body)
+}
+
+// Is allows to match ErrServerBusy using errors.Is when the HTTP
+// status is 429 Too Many Requests, 502 Bad Gateway, 503 Service
+// Unavailable or 504 Gateway Timeout.
+func (e *HTTPError) Is(target error) bool {
+	if target != ErrServerBusy {
+		return false
+	}
+	switch e.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// SOAPFault is returned when the Vitotrol™ server answers with a SOAP
+// 1.1 Fault. The HTTP response it comes from is available using
+// errors.As with a *HTTPError target.
+type SOAPFault struct {
+	Code   string // faultcode, as soap:Client or soap:Server
+	String string // faultstring, human readable explanation
+	Actor  string // faultactor, generally empty
+	Detail string // raw XML contents of detail element, if any
+
+	httpError *HTTPError
+}
+
+// Error returns the SOAP fault as a string.
+func (e *SOAPFault) Error() string {
+	str := fmt.Sprintf("SOAP fault %s: %s", e.Code, e.String)
+	if e.Detail != "" {
+		str += " (" + e.Detail + ")"
+	}
+	return str
+}
+
+// Unwrap returns the *HTTPError the SOAP fault comes from, if any.
+func (e *SOAPFault) Unwrap() error {
+	if e.httpError == nil {
+		return nil
+	}
+	return e.httpError
+}
+
+type soapFaultEnvelope struct {
+	Fault *struct {
+		Code   string `xml:"faultcode"`
+		String string `xml:"faultstring"`
+		Actor  string `xml:"faultactor"`
+		Detail struct {
+			Inner string `xml:",innerxml"`
+		} `xml:"detail"`
+	} `xml:"Body>Fault"`
+}
+
+// parseSOAPFault extracts the SOAP fault contained in the body of
+// httpErr. If no SOAP fault can be found, httpErr is returned as is.
+func parseSOAPFault(httpErr *HTTPError) error {
+	var envelope soapFaultEnvelope
+	if xml.Unmarshal(httpErr.Body, &envelope) != nil || envelope.Fault == nil {
+		return httpErr
+	}
+
+	return &SOAPFault{
+		Code:      strings.TrimSpace(envelope.Fault.Code),
+		String:    strings.TrimSpace(envelope.Fault.String),
+		Actor:     strings.TrimSpace(envelope.Fault.Actor),
+		Detail:    strings.TrimSpace(envelope.Fault.Detail.Inner),
+		httpError: httpErr,
+	}
+}
@@ -0,0 +1,79 @@
+package vitotrol
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+func TestHTTPError(tt *testing.T) {
+	t := td.NewT(tt)
+
+	err := &HTTPError{
+		StatusCode: http.StatusServiceUnavailable,
+		Body:       []byte("Try later"),
+	}
+	t.CmpDeeply(err.Error(), "HTTP error: [status=503] Try later")
+	t.True(errors.Is(err, ErrServerBusy))
+	t.False(errors.Is(err, ErrSessionExpired))
+
+	for _, status := range []int{429, 502, 503, 504} {
+		err.StatusCode = status
+		t.True(errors.Is(err, ErrServerBusy), "status %d", status)
+	}
+
+	err.StatusCode = http.StatusNotFound
+	t.False(errors.Is(err, ErrServerBusy))
+}
+
+func TestSOAPFault(tt *testing.T) {
+	t := td.NewT(tt)
+
+	httpErr := &HTTPError{
+		StatusCode: http.StatusInternalServerError,
+		Body: []byte(respHeader + `<soap:Fault>
+  <faultcode>soap:Server</faultcode>
+  <faultstring>Server was unable to process request.</faultstring>
+  <detail><Reason>NullReferenceException</Reason></detail>
+</soap:Fault>` + respFooter),
+	}
+
+	err := parseSOAPFault(httpErr)
+	if t.Isa(err, &SOAPFault{}) {
+		fault := err.(*SOAPFault)
+		t.CmpDeeply(fault, td.Struct(&SOAPFault{
+			Code:   "soap:Server",
+			String: "Server was unable to process request.",
+			Detail: "<Reason>NullReferenceException</Reason>",
+		}, nil))
+		t.CmpDeeply(err.Error(),
+			"SOAP fault soap:Server: Server was unable to process request. "+
+				"(<Reason>NullReferenceException</Reason>)")
+
+		var target *HTTPError
+		if t.True(errors.As(err, &target)) {
+			t.Shallow(target, httpErr)
+		}
+	}
+
+	// Without detail
+	err = parseSOAPFault(&HTTPError{
+		StatusCode: http.StatusInternalServerError,
+		Body: []byte(respHeader + `<soap:Fault>
+  <faultcode>soap:Client</faultcode>
+  <faultstring>Bad request</faultstring>
+</soap:Fault>` + respFooter),
+	})
+	t.CmpDeeply(err.Error(), "SOAP fault soap:Client: Bad request")
+
+	// Not a SOAP fault
+	httpErr = &HTTPError{
+		StatusCode: http.StatusInternalServerError,
+		Body:       []byte("<html>Internal error</html>"),
+	}
+	t.Shallow(parseSOAPFault(httpErr), httpErr)
+
+	t.Nil((&SOAPFault{}).Unwrap())
+}
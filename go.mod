@@ -1,6 +1,6 @@
 module github.com/maxatome/go-vitotrol
 
-go 1.18
+go 1.21
 
 require github.com/maxatome/go-testdeep v1.14.0
 
@@ -0,0 +1,77 @@
+package vitotrol
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// discardHandler is a slog.Handler dropping all records.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// logger returns the logger of the session. If Logger is nil and
+// Debug is true, records are written at debug level to the standard
+// logger. Otherwise, they are discarded.
+func (v *Session) logger() *slog.Logger {
+	if v.Logger != nil {
+		return v.Logger
+	}
+	if v.Debug {
+		return slog.New(slog.NewTextHandler(log.Writer(),
+			&slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	return discardLogger
+}
+
+const redacted = "REDACTED"
+
+var reRedactPassword = regexp.MustCompile(`(<Passwort>)[^<]*(</Passwort>)`)
+
+// redactBody returns body with the password of Login requests
+// replaced by REDACTED.
+func redactBody(body []byte) string {
+	return reRedactPassword.ReplaceAllString(string(body), "${1}"+redacted+"${2}")
+}
+
+// redactCookies returns cookies with their values replaced by
+// REDACTED. Only the names and the attributes of cookies are kept.
+func redactCookies(cookies []string) []string {
+	if cookies == nil {
+		return nil
+	}
+
+	res := make([]string, len(cookies))
+	for i, cookie := range cookies {
+		value, attrs, _ := strings.Cut(cookie, ";")
+		name, _, _ := strings.Cut(value, "=")
+		res[i] = name + "=" + redacted
+		if attrs != "" {
+			res[i] += ";" + attrs
+		}
+	}
+	return res
+}
+
+// hasDevice is implemented by requests targeting a device.
+type hasDevice interface {
+	device() deviceRequest
+}
+
+// requestAttrs returns the logging attributes identifying the device
+// targeted by request, if any.
+func requestAttrs(request interface{}) []interface{} {
+	if r, ok := request.(hasDevice); ok {
+		d := r.device()
+		return []interface{}{"device", d.DeviceID, "location", d.LocationID}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package vitotrol
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+func TestRedact(tt *testing.T) {
+	t := td.NewT(tt)
+
+	t.CmpDeeply(
+		redactBody([]byte(`<Login><Passwort>s3cr&amp;t</Passwort><Benutzer>me</Benutzer></Login>`)),
+		`<Login><Passwort>REDACTED</Passwort><Benutzer>me</Benutzer></Login>`)
+	t.CmpDeeply(redactBody([]byte(`<GetDevices></GetDevices>`)),
+		`<GetDevices></GetDevices>`)
+
+	t.Nil(redactCookies(nil))
+	t.CmpDeeply(
+		redactCookies([]string{"sid=1234; path=/; HttpOnly", "foo=bar", "bare"}),
+		[]string{"sid=REDACTED; path=/; HttpOnly", "foo=REDACTED", "bare=REDACTED"})
+}
+
+func TestLogger(tt *testing.T) {
+	t := td.NewT(tt)
+
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Set-Cookie", "sid=s3cr3t-cookie; path=/")
+			switch r.Header.Get("SOAPAction") {
+			case soapURL + "Login":
+				fmt.Fprintln(w, respHeader+`<LoginResponse><LoginResult>
+<Ergebnis>0</Ergebnis><ErgebnisText>Kein Fehler</ErgebnisText>
+</LoginResult></LoginResponse>`+respFooter)
+			default:
+				fmt.Fprintln(w, respHeader+`<GetTypeInfoResponse><GetTypeInfoResult>
+<Ergebnis>42</Ergebnis><ErgebnisText>Bad</ErgebnisText>
+</GetTypeInfoResult></GetTypeInfoResponse>`+respFooter)
+			}
+		}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	v := NewSession(
+		WithEndpoint(ts.URL),
+		WithLogger(slog.New(slog.NewJSONHandler(&buf,
+			&slog.HandlerOptions{Level: slog.LevelDebug}))),
+	)
+
+	t.CmpNoError(v.Login("pipo", "bingo"))
+	d := &Device{DeviceID: 12, LocationID: 34}
+	_, err := d.GetTypeInfoContext(context.Background(), v)
+	t.CmpError(err)
+
+	t.False(strings.Contains(buf.String(), "bingo"), "password redacted")
+	t.False(strings.Contains(buf.String(), "s3cr3t-cookie"), "cookies redacted")
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if !t.CmpNoError(json.Unmarshal([]byte(line), &record)) {
+			return
+		}
+		delete(record, "time")
+		records = append(records, record)
+	}
+
+	t.Cmp(records, td.Slice([]map[string]interface{}{}, td.ArrayEntries{
+		0: td.SuperMapOf(map[string]interface{}{
+			"level":  "DEBUG",
+			"msg":    "SOAP request body",
+			"action": "Login",
+			"body":   td.Contains("<Passwort>REDACTED</Passwort>"),
+		}, nil),
+		1: td.SuperMapOf(map[string]interface{}{
+			"level":   "DEBUG",
+			"msg":     "SOAP response body",
+			"cookies": []interface{}{"sid=REDACTED; path=/"},
+		}, nil),
+		2: td.SuperMapOf(map[string]interface{}{
+			"level":    "DEBUG",
+			"msg":      "SOAP request",
+			"action":   "Login",
+			"status":   float64(200),
+			"result":   float64(0),
+			"duration": td.Gte(float64(0)),
+		}, nil),
+		3: td.SuperMapOf(map[string]interface{}{
+			"msg":     "SOAP request body",
+			"cookies": []interface{}{"sid=REDACTED; path=/"},
+		}, nil),
+		4: td.SuperMapOf(map[string]interface{}{
+			"msg": "SOAP response body",
+		}, nil),
+		5: td.SuperMapOf(map[string]interface{}{
+			"level":    "WARN",
+			"msg":      "SOAP request",
+			"action":   "GetTypeInfo",
+			"device":   float64(12),
+			"location": float64(34),
+			"status":   float64(200),
+			"result":   float64(42),
+			"error":    "Bad [#42]",
+		}, nil),
+	}))
+
+	// No logger: nothing logged, nothing broken
+	v = NewSession(WithEndpoint(ts.URL))
+	t.Shallow(v.logger(), discardLogger)
+	t.CmpNoError(v.Login("pipo", "bingo"))
+}
@@ -0,0 +1,140 @@
+package vitotrol
+
+import (
+	"context"
+	"sync"
+)
+
+// Operation is an asynchronous operation started on the Vitotrol™
+// server by a WriteData, RefreshData or WriteTimesheetData request,
+// and whose completion is polled using RequestWriteStatus or
+// RequestRefreshStatus. See Device.StartWriteData,
+// Device.StartRefreshData and Device.StartWriteTimesheetData.
+type Operation struct {
+	id         string
+	done       chan struct{}
+	cancel     context.CancelFunc
+	onProgress func(status AsyncStatus)
+	wait       *WaitConfig
+	verify     *bool
+	check      func(ctx context.Context) error // called on success if not nil
+
+	mu     sync.Mutex
+	status AsyncStatus
+	err    error
+}
+
+// An OperationOption configures an Operation.
+type OperationOption func(*Operation)
+
+// WithProgress sets a function called with each intermediate status
+// received while the operation is not yet complete. It is called
+// from the polling goroutine, so it must not block.
+func WithProgress(fn func(status AsyncStatus)) OperationOption {
+	return func(o *Operation) {
+		o.onProgress = fn
+	}
+}
+
+func newOperation(ctx context.Context, refreshID string, options []OperationOption) (*Operation, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	o := &Operation{
+		id:     refreshID,
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	for _, option := range options {
+		option(o)
+	}
+	return o, ctx
+}
+
+// ID returns the "refresh ID" of the operation, as returned by the
+// Vitotrol™ server.
+func (o *Operation) ID() string {
+	return o.id
+}
+
+// Status returns the last status received for the operation, or nil
+// if none has been received yet.
+func (o *Operation) Status() AsyncStatus {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.status
+}
+
+// Done returns a channel closed when the operation is complete,
+// failed or has been canceled.
+func (o *Operation) Done() <-chan struct{} {
+	return o.done
+}
+
+// Err returns nil while the operation is not done. Then it returns
+// nil if the operation succeeded, or the reason of its failure.
+func (o *Operation) Err() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.err
+}
+
+// Wait waits for the end of the operation and returns Err. If ctx is
+// done before, its error is returned, but the operation goes on; use
+// Cancel to stop it.
+func (o *Operation) Wait(ctx context.Context) error {
+	select {
+	case <-o.done:
+		return o.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Cancel stops polling the status of the operation. The operation
+// then fails with context.Canceled, unless it was already done. Note
+// that the operation itself cannot be canceled on the Vitotrol™
+// server.
+func (o *Operation) Cancel() {
+	o.cancel()
+}
+
+// progress records the intermediate status.
+func (o *Operation) progress(status AsyncStatus) {
+	o.mu.Lock()
+	o.status = status
+	o.mu.Unlock()
+
+	if o.onProgress != nil {
+		o.onProgress(status)
+	}
+}
+
+// finish ends the operation with err, after status has been received
+// if not nil.
+func (o *Operation) finish(status AsyncStatus, err error) {
+	o.mu.Lock()
+	if status != nil {
+		o.status = status
+	}
+	o.err = err
+	o.mu.Unlock()
+
+	o.cancel()
+	close(o.done)
+}
+
+// errChan returns a channel on which the error of the operation is
+// sent, if any, before being closed. As the channel is buffered, the
+// goroutine feeding it never leaks, even if nobody reads it.
+func (o *Operation) errChan() <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		<-o.done
+		if err := o.Err(); err != nil {
+			ch <- err
+		}
+		close(ch)
+	}()
+	return ch
+}
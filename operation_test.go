@@ -0,0 +1,139 @@
+package vitotrol
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+// newOperationServer returns a server answering RefreshData and
+// WriteData requests, then RequestRefreshStatus and
+// RequestWriteStatus ones with statuses, the last one being
+// repeated.
+func newOperationServer(statuses ...int) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			action := r.Header.Get("SOAPAction")
+			action = action[strings.LastIndex(action, "/")+1:]
+
+			switch action {
+			case "RefreshData", "WriteData":
+				fmt.Fprintln(w, respHeader+intoDeviceResponse(action, `<Ergebnis>0</Ergebnis>
+<ErgebnisText>Kein Fehler</ErgebnisText>
+<AktualisierungsId>123456789</AktualisierungsId>`)+respFooter)
+
+			default:
+				mu.Lock()
+				status := statuses[0]
+				if len(statuses) > 1 {
+					statuses = statuses[1:]
+				}
+				mu.Unlock()
+
+				fmt.Fprintf(w, respHeader+`<%[1]sResponse><%[1]sResult>
+<Ergebnis>0</Ergebnis>
+<ErgebnisText>Kein Fehler</ErgebnisText>
+<Status>%[2]d</Status>
+</%[1]sResult></%[1]sResponse>`+respFooter, action, status)
+			}
+		}))
+}
+
+func TestOperation(tt *testing.T) {
+	t := td.NewT(tt)
+
+	noWait := WithDefaultWait(WaitConfig{First: -1, Min: -1})
+	d := &Device{DeviceID: testDeviceID, LocationID: testLocationID}
+
+	t.Run("success", func(t *td.T) {
+		ts := newOperationServer(1, 3, 4)
+		defer ts.Close()
+		v := NewSession(WithEndpoint(ts.URL), noWait)
+
+		var progress []AsyncStatus
+		op, err := d.StartRefreshData(context.Background(), v, refreshDataTestIDs,
+			WithProgress(func(status AsyncStatus) { progress = append(progress, status) }))
+		if !t.CmpNoError(err) {
+			return
+		}
+		t.Cmp(op.ID(), "123456789")
+
+		t.CmpNoError(op.Wait(context.Background()))
+		t.CmpNoError(op.Err())
+		t.Cmp(op.Status(), RefreshDone)
+		t.Cmp(progress, []AsyncStatus{RefreshPending, RefreshInProgress})
+
+		select {
+		case <-op.Done():
+		default:
+			t.Error("Done channel not closed")
+		}
+	})
+
+	t.Run("unexpected status", func(t *td.T) {
+		ts := newOperationServer(1, 5)
+		defer ts.Close()
+		v := NewSession(WithEndpoint(ts.URL), noWait)
+
+		op, err := d.StartRefreshData(context.Background(), v, refreshDataTestIDs)
+		if !t.CmpNoError(err) {
+			return
+		}
+		err = op.Wait(context.Background())
+		t.Cmp(err, &UnexpectedStatusError{Status: RefreshStatus(5)})
+		t.Cmp(err, td.String("Unexpected status 5"))
+		t.Cmp(op.Status(), RefreshStatus(5))
+	})
+
+	t.Run("cancel", func(t *td.T) {
+		ts := newOperationServer(1)
+		defer ts.Close()
+		v := NewSession(WithEndpoint(ts.URL), noWait)
+
+		op, err := d.StartRefreshData(context.Background(), v, refreshDataTestIDs)
+		if !t.CmpNoError(err) {
+			return
+		}
+		t.Nil(op.Err())
+
+		// Wait context done, but the operation goes on
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		t.CmpErrorIs(op.Wait(ctx), context.DeadlineExceeded)
+		t.Nil(op.Err())
+
+		op.Cancel()
+		t.CmpErrorIs(op.Wait(context.Background()), context.Canceled)
+		t.Cmp(op.Status(), RefreshPending)
+	})
+}
+
+func TestWaitChannelNotLeaking(tt *testing.T) {
+	t := td.NewT(tt)
+
+	ts := newOperationServer(5)
+	defer ts.Close()
+	v := NewSession(WithEndpoint(ts.URL),
+		WithDefaultWait(WaitConfig{First: -1, Min: -1}))
+
+	d := &Device{DeviceID: testDeviceID, LocationID: testLocationID}
+	ch, err := d.WriteDataWait(v, writeDataTestID, writeDataTestValue)
+	if !t.CmpNoError(err) {
+		return
+	}
+
+	// Nobody reads ch before the operation is done, the error is
+	// buffered
+	t.Cmp(cap(ch), 1)
+	t.Cmp(<-ch, td.String("Unexpected status 5"))
+	_, ok := <-ch
+	t.False(ok, "channel closed")
+}
@@ -0,0 +1,134 @@
+package vitotrol
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// An Option configures a Session. See NewSession.
+type Option func(*Session)
+
+// WithEndpoint sets the URL of the Vitodata API used by the
+// session. MainURL is used by default.
+func WithEndpoint(url string) Option {
+	return func(v *Session) {
+		v.endpoint = url
+	}
+}
+
+// WithServiceVersion sets the endpoint of the session to the
+// Viessmann Vitodata API URL corresponding to version. See
+// ServiceURL.
+func WithServiceVersion(version string) Option {
+	return WithEndpoint(ServiceURL(version))
+}
+
+// WithSOAPNamespace sets the SOAP namespace used in requests
+// envelopes and SOAPAction headers.
+func WithSOAPNamespace(namespace string) Option {
+	return func(v *Session) {
+		v.namespace = namespace
+	}
+}
+
+// WithHTTPClient sets the HTTP client used by the session. See
+// Session.HTTPClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(v *Session) {
+		v.HTTPClient = client
+	}
+}
+
+// WithTransport sets the HTTP transport used by the session. See
+// Session.Transport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(v *Session) {
+		v.Transport = transport
+	}
+}
+
+// WithDebug enables or disables the debug mode of the session.
+func WithDebug(debug bool) Option {
+	return func(v *Session) {
+		v.Debug = debug
+	}
+}
+
+// WithLogger sets the structured logger of the session. See
+// Session.Logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(v *Session) {
+		v.Logger = logger
+	}
+}
+
+// WithCredentials sets the credentials provider used by
+// Session.LoginWithCredentials and to automatically re-authenticate
+// the session when it expires. Note that the automatic re-login is
+// disabled unless WithSessionExpiry or WithResultErrors is used too,
+// as the expiration cannot be detected otherwise.
+func WithCredentials(provider CredentialsProvider) Option {
+	return func(v *Session) {
+		v.credentials = provider
+	}
+}
+
+// WithResultErrors sets the errors the result codes of the
+// Vitotrol™ server are mapped to. See Session.ResultErrors.
+func WithResultErrors(errs map[int]error) Option {
+	return func(v *Session) {
+		v.ResultErrors = make(map[int]error, len(errs))
+		for code, err := range errs {
+			v.ResultErrors[code] = err
+		}
+	}
+}
+
+// WithSessionExpiry sets the function reporting whether an error
+// means that the session expired and has to be automatically
+// re-authenticated. See Session.SessionExpired and MatchResult.
+func WithSessionExpiry(isExpired func(err error) bool) Option {
+	return func(v *Session) {
+		v.SessionExpired = isExpired
+	}
+}
+
+// WithReloginHook sets the function called each time the session is
+// automatically re-authenticated. See Session.OnRelogin.
+func WithReloginHook(hook func(err error)) Option {
+	return func(v *Session) {
+		v.OnRelogin = hook
+	}
+}
+
+// WithRetryPolicy sets the retry policy applied to idempotent
+// requests. See RetryPolicy and DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(v *Session) {
+		v.Retry = &policy
+	}
+}
+
+// WithRateLimiter sets the rate limiter throttling the requests sent
+// by the session. See Session.RateLimiter.
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(v *Session) {
+		v.RateLimiter = limiter
+	}
+}
+
+// WithRateLimit throttles the requests sent by the session to rate
+// requests per second on average, with bursts of at most burst
+// requests. See NewTokenBucket.
+func WithRateLimit(rate float64, burst int) Option {
+	return WithRateLimiter(NewTokenBucket(rate, burst))
+}
+
+// WithSerializedRequests ensures that at most one request at a time
+// is in flight for the session, whatever the number of goroutines
+// using it. See Session.SerializeRequests.
+func WithSerializedRequests() Option {
+	return func(v *Session) {
+		v.SerializeRequests = true
+	}
+}
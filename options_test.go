@@ -0,0 +1,75 @@
+package vitotrol
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+func TestNewSession(tt *testing.T) {
+	t := td.NewT(tt)
+
+	// Defaults
+	v := NewSession()
+	t.CmpDeeply(v.Endpoint(), MainURL)
+	t.CmpDeeply(v.SOAPNamespace(), soapURL)
+	t.Nil(v.HTTPClient)
+	t.Nil(v.Transport)
+	t.False(v.Debug)
+
+	client := &http.Client{}
+	transport := &http.Transport{}
+	v = NewSession(
+		WithServiceVersion("1.2.3.4"),
+		WithSOAPNamespace("http://example.com/ns/"),
+		WithHTTPClient(client),
+		WithTransport(transport),
+		WithDebug(true),
+	)
+	t.CmpDeeply(v.Endpoint(),
+		"https://www.viessmann.com/app_vitodata/VIIWebService-1.2.3.4/iPhoneWebService.asmx")
+	t.CmpDeeply(v.SOAPNamespace(), "http://example.com/ns/")
+	t.Shallow(v.HTTPClient, client)
+	t.Shallow(v.Transport, transport)
+	t.True(v.Debug)
+
+	// Last option wins
+	v = NewSession(WithServiceVersion("1.2.3.4"), WithEndpoint("http://local/"))
+	t.CmpDeeply(v.Endpoint(), "http://local/")
+}
+
+func TestSessionsEndpoints(tt *testing.T) {
+	t := td.NewT(tt)
+
+	newServer := func(name, namespace string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				t.CmpDeeply(r.Header.Get("SOAPAction"), namespace+"Login",
+					"%s: SOAPAction header matches", name)
+				w.Write([]byte(respHeader + //nolint: errcheck
+					intoDeviceResponse("Login", `<Ergebnis>0</Ergebnis>
+<ErgebnisText>`+name+`</ErgebnisText>`) +
+					respFooter))
+			}))
+	}
+
+	ts1 := newServer("one", soapURL)
+	defer ts1.Close()
+	ts2 := newServer("two", "http://example.com/ns/")
+	defer ts2.Close()
+
+	MainURL = "bad-scheme:..."
+
+	v1 := NewSession(WithEndpoint(ts1.URL))
+	v2 := NewSession(
+		WithEndpoint(ts2.URL),
+		WithSOAPNamespace("http://example.com/ns/"))
+
+	t.CmpNoError(v1.Login("pipo", "bingo"))
+	t.CmpNoError(v2.Login("pipo", "bingo"))
+
+	// Zero session still uses MainURL
+	t.CmpError((&Session{}).Login("pipo", "bingo"))
+}
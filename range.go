@@ -0,0 +1,139 @@
+package vitotrol
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// AttrRange constrains the values of a numeric attribute.
+type AttrRange struct {
+	Min  float64
+	Max  float64
+	Step float64 // if not 0, values must be Min + N × Step
+}
+
+// String returns the range as a string.
+func (r *AttrRange) String() string {
+	str := fmt.Sprintf("[%s, %s]", formatFloat(r.Min), formatFloat(r.Max))
+	if r.Step != 0 {
+		str += " step " + formatFloat(r.Step)
+	}
+	return str
+}
+
+// Check returns an *OutOfRangeError if value is not in the range, or
+// does not respect its step.
+func (r *AttrRange) Check(value float64) error {
+	if value < r.Min || value > r.Max {
+		return &OutOfRangeError{Value: value, Range: *r}
+	}
+	if r.Step != 0 {
+		steps := (value - r.Min) / r.Step
+		if math.Abs(steps-math.Round(steps)) > 1e-9 {
+			return &OutOfRangeError{Value: value, Range: *r}
+		}
+	}
+	return nil
+}
+
+// OutOfRangeError is returned when a value is not allowed by the
+// AttrRange of an attribute. See Device.ValidateValue.
+type OutOfRangeError struct {
+	Name  string // name of the attribute, if known
+	Value float64
+	Range AttrRange
+}
+
+// Error returns the error as a string.
+func (e *OutOfRangeError) Error() string {
+	str := "Value " + formatFloat(e.Value)
+	if e.Name != "" {
+		str += " of " + e.Name
+	}
+	return str + " is out of range " + e.Range.String()
+}
+
+func formatFloat(num float64) string {
+	return strconv.FormatFloat(num, 'f', -1, 64)
+}
+
+// parseRange returns the range described by the GetTypeInfo min and
+// max strings. false is returned if they do not describe a range.
+func parseRange(min, max string) (*AttrRange, bool) {
+	minNum, err := strconv.ParseFloat(strings.Replace(min, ",", ".", 1), 64)
+	if err != nil {
+		return nil, false
+	}
+	maxNum, err := strconv.ParseFloat(strings.Replace(max, ",", ".", 1), 64)
+	if err != nil || maxNum <= minNum {
+		return nil, false
+	}
+	return &AttrRange{Min: minNum, Max: maxNum}, true
+}
+
+// Validate checks the Vitodata™ value against the type and the range
+// of the attribute described by r.
+func (r *AttrRef) Validate(value string) error {
+	native, err := r.Type.Vitodata2NativeValue(value)
+	if err != nil {
+		return err
+	}
+	if r.Range == nil {
+		return nil
+	}
+
+	var num float64
+	switch native := native.(type) {
+	case float64:
+		num = native
+	case int64:
+		num = float64(native)
+	default:
+		return nil
+	}
+
+	if err := r.Range.Check(num); err != nil {
+		err.(*OutOfRangeError).Name = r.Name
+		return err
+	}
+	return nil
+}
+
+// ValidateValue checks that the Vitodata™ value can be written to
+// attribute attrID, according to the registry of d: the attribute
+// must be known and writable, and value must be valid for its type
+// and in its range, if any. A range violation is reported using an
+// *OutOfRangeError.
+func (d *Device) ValidateValue(attrID AttrID, value string) error {
+	pRef := d.Registry().Ref(attrID)
+	if pRef == nil {
+		return fmt.Errorf("%w %d", ErrUnknownAttribute, attrID)
+	}
+	if pRef.Access&WriteOnly == 0 {
+		return fmt.Errorf("Attribute %s is not writable", pRef.Name)
+	}
+	return pRef.Validate(value)
+}
+
+// WriteValue converts the human value to the Vitodata™ format using
+// AttrRef.Human2VitodataValue of attribute attrID, so value can be
+// suffixed by a unit as "72F", checks it using ValidateValue, then
+// starts writing it using StartWriteData. Invalid values are never
+// sent to the Vitotrol™ server.
+func (d *Device) WriteValue(ctx context.Context, v *Session, attrID AttrID, value string, options ...OperationOption) (*Operation, error) {
+	if pRef := d.Registry().Ref(attrID); pRef != nil {
+		var err error
+		value, err = pRef.Human2VitodataValue(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.ValidateValue(attrID, value); err != nil {
+		return nil, err
+	}
+	return d.StartWriteData(ctx, v, attrID, value, options...)
+}
@@ -0,0 +1,92 @@
+package vitotrol
+
+import (
+	"context"
+	"testing"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+func TestAttrRange(tt *testing.T) {
+	t := td.NewT(tt)
+
+	r := AttrRange{Min: 10, Max: 60}
+	t.String(&r, "[10, 60]")
+	t.CmpNoError(r.Check(10))
+	t.CmpNoError(r.Check(42.5))
+	t.CmpNoError(r.Check(60))
+	t.Cmp(r.Check(600), &OutOfRangeError{Value: 600, Range: r})
+	t.Cmp(r.Check(9.9), &OutOfRangeError{Value: 9.9, Range: r})
+
+	r = AttrRange{Min: 3, Max: 37, Step: 0.5}
+	t.String(&r, "[3, 37] step 0.5")
+	t.CmpNoError(r.Check(3))
+	t.CmpNoError(r.Check(20.5))
+	t.Cmp(r.Check(20.2), &OutOfRangeError{Value: 20.2, Range: r})
+
+	t.String(&OutOfRangeError{Name: "Foo", Value: 600, Range: r},
+		"Value 600 of Foo is out of range [3, 37] step 0.5")
+	t.String(&OutOfRangeError{Value: 1.5, Range: AttrRange{Min: 2, Max: 4}},
+		"Value 1.5 is out of range [2, 4]")
+}
+
+func TestParseRange(tt *testing.T) {
+	t := td.NewT(tt)
+
+	r, ok := parseRange("10", "60")
+	t.True(ok)
+	t.Cmp(r, &AttrRange{Min: 10, Max: 60})
+
+	r, ok = parseRange("-3,5", "12,5")
+	t.True(ok)
+	t.Cmp(r, &AttrRange{Min: -3.5, Max: 12.5})
+
+	for _, minMax := range [][2]string{
+		{"", ""},
+		{"0", "0"},
+		{"10", "5"},
+		{"foo", "5"},
+		{"0", "bar"},
+	} {
+		_, ok = parseRange(minMax[0], minMax[1])
+		t.False(ok, "%q", minMax)
+	}
+}
+
+func TestValidateValue(tt *testing.T) {
+	t := td.NewT(tt)
+
+	var d Device
+
+	t.CmpNoError(d.ValidateValue(HotWaterSetpointTemp, "55"))
+	t.CmpNoError(d.ValidateValue(HeatNormalTemp, "21,0"))
+	t.CmpNoError(d.ValidateValue(OperatingModeRequested, "2"))
+	t.CmpNoError(d.ValidateValue(DateTime, "2024-03-01 12:00:00"))
+
+	t.Cmp(d.ValidateValue(HotWaterSetpointTemp, "600"), &OutOfRangeError{
+		Name:  "HotWaterSetpointTemp",
+		Value: 600,
+		Range: AttrRange{Min: 10, Max: 60},
+	})
+	t.CmpNoError(d.ValidateValue(HeatNormalTemp, "20.5"))
+	t.CmpError(d.ValidateValue(HeatNormalTemp, "abc"))
+	t.CmpErrorIs(d.ValidateValue(OperatingModeRequested, "12"), ErrEnumInvalidValue)
+	t.String(d.ValidateValue(IndoorTemp, "20"), "Attribute IndoorTemp is not writable")
+	t.String(d.ValidateValue(9876, "20"), "Unknown attribute 9876")
+
+	// The device registry is used
+	d.Registry().Add(9876, AttrRef{
+		Type:   TypeInteger,
+		Access: WriteOnly,
+		Name:   "Foo",
+		Range:  &AttrRange{Min: 0, Max: 100, Step: 10},
+	})
+	t.CmpNoError(d.ValidateValue(9876, "30"))
+	t.Cmp(d.ValidateValue(9876, "35"), td.Isa(&OutOfRangeError{}))
+
+	// WriteValue does not send invalid values
+	_, err := d.WriteValue(context.Background(), nil, HotWaterSetpointTemp, "600")
+	t.Cmp(err, td.Isa(&OutOfRangeError{}))
+	_, err = d.WriteValue(context.Background(), nil, HotWaterSetpointTemp, "abc")
+	t.CmpError(err)
+}
@@ -0,0 +1,140 @@
+package vitotrol
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A RateLimiter throttles the requests sent by a Session. See
+// Session.RateLimiter.
+type RateLimiter interface {
+	// Wait blocks until a request can be sent or ctx is done. In the
+	// latter case, the ctx error is returned.
+	Wait(ctx context.Context) error
+}
+
+// TokenBucket is a RateLimiter allowing bursts of requests and
+// refilling at a constant rate. It is safe for concurrent use.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a new TokenBucket allowing rate requests per
+// second on average, with bursts of at most burst requests. The
+// bucket starts full. A rate <= 0 means no limit.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// reserve takes a token and returns the duration to wait before
+// using it.
+func (b *TokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *TokenBucket) cancel() {
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+}
+
+// clockedRateLimiter is a RateLimiter able to wait according to the
+// clock of the session using it, see Session.Clock.
+type clockedRateLimiter interface {
+	waitClock(ctx context.Context, clock Clock) error
+}
+
+// Wait blocks until a token is available or ctx is done. In the
+// latter case, the token is given back and the ctx error is returned.
+// When used by a Session, the bucket follows its Clock.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	return b.waitClock(ctx, SystemClock)
+}
+
+func (b *TokenBucket) waitClock(ctx context.Context, clock Clock) error {
+	if b.rate <= 0 {
+		return ctx.Err()
+	}
+
+	wait := b.reserve(clock.Now())
+	if wait <= 0 {
+		return nil
+	}
+
+	if err := sleepContext(ctx, clock, wait); err != nil {
+		b.cancel()
+		return err
+	}
+	return nil
+}
+
+// serialSlot returns the channel holding the in-flight request of
+// the session, creating it the first time.
+func (v *Session) serialSlot() chan struct{} {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.serial == nil {
+		v.serial = make(chan struct{}, 1)
+	}
+	return v.serial
+}
+
+// acquire blocks until the session is allowed to send a request,
+// following its SerializeRequests and RateLimiter fields. The
+// returned function must be called once the request is done.
+func (v *Session) acquire(ctx context.Context) (func(), error) {
+	release := func() {}
+
+	if v.SerializeRequests {
+		serial := v.serialSlot()
+		select {
+		case serial <- struct{}{}:
+			release = func() { <-serial }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if v.RateLimiter != nil {
+		var err error
+		if limiter, ok := v.RateLimiter.(clockedRateLimiter); ok {
+			err = limiter.waitClock(ctx, v.clock())
+		} else {
+			err = v.RateLimiter.Wait(ctx)
+		}
+		if err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	return release, nil
+}
@@ -0,0 +1,158 @@
+package vitotrol
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+// stubClock is a Clock whose time never goes on. Its timers record
+// their duration and fire immediately, or never if hold is true.
+type stubClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	hold    bool
+	onTimer func()
+	waits   []time.Duration
+	stopped int
+}
+
+func (c *stubClock) Now() time.Time {
+	return c.now
+}
+
+func (c *stubClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	c.waits = append(c.waits, d)
+	c.mu.Unlock()
+
+	if c.onTimer != nil {
+		c.onTimer()
+	}
+
+	ch := make(chan time.Time, 1)
+	if !c.hold {
+		ch <- c.now
+	}
+	return &stubTimer{clock: c, ch: ch}
+}
+
+type stubTimer struct {
+	clock *stubClock
+	ch    chan time.Time
+}
+
+func (t *stubTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *stubTimer) Stop() bool {
+	t.clock.mu.Lock()
+	t.clock.stopped++
+	t.clock.mu.Unlock()
+	return t.clock.hold
+}
+
+func TestTokenBucket(tt *testing.T) {
+	t := td.NewT(tt)
+
+	b := NewTokenBucket(10, 2)
+	now := time.Now()
+
+	// Burst
+	t.CmpDeeply(b.reserve(now), time.Duration(0))
+	t.CmpDeeply(b.reserve(now), time.Duration(0))
+	// Then 1 token every 100ms
+	t.CmpDeeply(b.reserve(now), 100*time.Millisecond)
+	t.CmpDeeply(b.reserve(now), 200*time.Millisecond)
+
+	// Refill, capped to burst
+	now = now.Add(time.Hour)
+	t.CmpDeeply(b.reserve(now), time.Duration(0))
+	t.CmpDeeply(b.reserve(now), time.Duration(0))
+	t.CmpDeeply(b.reserve(now), 100*time.Millisecond)
+
+	// Canceled wait gives back its token
+	b = NewTokenBucket(1, 1)
+	t.CmpNoError(b.Wait(context.Background()))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	t.CmpErrorIs(b.Wait(ctx), context.Canceled)
+	t.Between(b.tokens, -0.1, 0.1, td.BoundsInIn)
+
+	// No limit
+	b = NewTokenBucket(0, 0)
+	for i := 0; i < 100; i++ {
+		t.CmpNoError(b.Wait(context.Background()))
+	}
+}
+
+func TestSessionRateLimit(tt *testing.T) {
+	t := td.NewT(tt)
+
+	var inFlight, maxInFlight, count int32
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+					break
+				}
+			}
+			atomic.AddInt32(&count, 1)
+
+			time.Sleep(5 * time.Millisecond)
+			fmt.Fprintln(w, respHeader+intoDeviceResponse("RequestRefreshStatus",
+				`<Ergebnis>0</Ergebnis><Status>4</Status>`)+respFooter)
+		}))
+	defer ts.Close()
+
+	run := func(v *Session) {
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := v.RequestRefreshStatus("1")
+				t.CmpNoError(err)
+			}()
+		}
+		wg.Wait()
+	}
+
+	// Serialized requests
+	run(NewSession(WithEndpoint(ts.URL), WithSerializedRequests()))
+	t.CmpDeeply(atomic.LoadInt32(&maxInFlight), int32(1))
+	t.CmpDeeply(atomic.LoadInt32(&count), int32(5))
+
+	// Same using the field, the slot being created on first use
+	atomic.StoreInt32(&maxInFlight, 0)
+	run(&Session{endpoint: ts.URL, SerializeRequests: true})
+	t.CmpDeeply(atomic.LoadInt32(&maxInFlight), int32(1))
+	t.CmpDeeply(atomic.LoadInt32(&count), int32(10))
+
+	// Rate limited requests: 1 burst, then 1 every second
+	clock := &stubClock{now: time.Now()}
+	run(NewSession(WithEndpoint(ts.URL), WithClock(clock), WithRateLimit(1, 1)))
+	t.CmpDeeply(clock.waits,
+		td.Bag(time.Second, 2*time.Second, 3*time.Second, 4*time.Second))
+	t.CmpDeeply(atomic.LoadInt32(&count), int32(15))
+
+	// Canceled while waiting for the in-flight slot
+	v := NewSession(WithEndpoint(ts.URL), WithSerializedRequests())
+	v.serialSlot() <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := v.RequestRefreshStatusContext(ctx, "1")
+	t.CmpErrorIs(err, context.Canceled)
+	t.CmpDeeply(atomic.LoadInt32(&count), int32(15))
+}
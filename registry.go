@@ -0,0 +1,174 @@
+package vitotrol
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// AttributeRegistry is a catalog of attributes and timesheets
+// references, indexed by ID and by name. Each Device owns its own
+// registry, so devices with different catalogs (as a gas boiler and
+// a heat pump) can be handled in the same program. See
+// Device.Registry.
+//
+// An AttributeRegistry is safe for concurrent use by multiple
+// goroutines.
+type AttributeRegistry struct {
+	mu             sync.RWMutex
+	refs           map[AttrID]*AttrRef
+	names          map[string]AttrID
+	timesheets     map[TimesheetID]*TimesheetRef
+	timesheetNames map[string]TimesheetID
+}
+
+// NewAttributeRegistry returns a new registry seeded with the
+// built-in catalog, that is AttributesRef including the attributes
+// added using AddAttributeRef before the call, and TimesheetsRef.
+func NewAttributeRegistry() *AttributeRegistry {
+	r := &AttributeRegistry{
+		refs:           make(map[AttrID]*AttrRef, len(AttributesRef)),
+		names:          make(map[string]AttrID, len(AttributesRef)),
+		timesheets:     make(map[TimesheetID]*TimesheetRef, len(TimesheetsRef)),
+		timesheetNames: make(map[string]TimesheetID, len(TimesheetsRef)),
+	}
+	for attrID, pRef := range AttributesRef {
+		r.add(attrID, *pRef)
+	}
+	for timesheetID, pRef := range TimesheetsRef {
+		r.addTimesheet(timesheetID, *pRef)
+	}
+	return r
+}
+
+// Ref returns the reference of attribute attrID, or nil if it is not
+// known. The returned AttrRef must not be modified.
+func (r *AttributeRegistry) Ref(attrID AttrID) *AttrRef {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.refs[attrID]
+}
+
+// name returns the name of attribute attrID, or its numeric form if
+// it is not known.
+func (r *AttributeRegistry) name(attrID AttrID) string {
+	if pRef := r.Ref(attrID); pRef != nil {
+		return pRef.Name
+	}
+	return fmt.Sprintf("#%d", attrID)
+}
+
+// ID returns the AttrID of the attribute named name. false is
+// returned if no attribute has this name.
+func (r *AttributeRegistry) ID(name string) (AttrID, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	attrID, ok := r.names[name]
+	return attrID, ok
+}
+
+// IDs returns the sorted AttrIDs of all the attributes of the
+// registry.
+func (r *AttributeRegistry) IDs() []AttrID {
+	r.mu.RLock()
+	ids := make([]AttrID, 0, len(r.refs))
+	for attrID := range r.refs {
+		ids = append(ids, attrID)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Add adds the attribute attrID to the registry, replacing any
+// previous reference with the same AttrID.
+func (r *AttributeRegistry) Add(attrID AttrID, ref AttrRef) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.add(attrID, ref)
+}
+
+func (r *AttributeRegistry) add(attrID AttrID, ref AttrRef) {
+	if old := r.refs[attrID]; old != nil && r.names[old.Name] == attrID {
+		delete(r.names, old.Name)
+	}
+	r.refs[attrID] = &ref
+	r.names[ref.Name] = attrID
+}
+
+// Timesheet returns the reference of timesheet timesheetID, or nil if
+// it is not known. The returned TimesheetRef must not be modified.
+func (r *AttributeRegistry) Timesheet(timesheetID TimesheetID) *TimesheetRef {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.timesheets[timesheetID]
+}
+
+// TimesheetID returns the TimesheetID of the timesheet named
+// name. false is returned if no timesheet has this name.
+func (r *AttributeRegistry) TimesheetID(name string) (TimesheetID, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	timesheetID, ok := r.timesheetNames[name]
+	return timesheetID, ok
+}
+
+// TimesheetIDs returns the sorted TimesheetIDs of all the timesheets
+// of the registry.
+func (r *AttributeRegistry) TimesheetIDs() []TimesheetID {
+	r.mu.RLock()
+	ids := make([]TimesheetID, 0, len(r.timesheets))
+	for timesheetID := range r.timesheets {
+		ids = append(ids, timesheetID)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// AddTimesheet adds the timesheet timesheetID to the registry,
+// replacing any previous reference with the same TimesheetID.
+func (r *AttributeRegistry) AddTimesheet(timesheetID TimesheetID, ref TimesheetRef) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addTimesheet(timesheetID, ref)
+}
+
+func (r *AttributeRegistry) addTimesheet(timesheetID TimesheetID, ref TimesheetRef) {
+	if old := r.timesheets[timesheetID]; old != nil &&
+		r.timesheetNames[old.Name] == timesheetID {
+		delete(r.timesheetNames, old.Name)
+	}
+	r.timesheets[timesheetID] = &ref
+	r.timesheetNames[ref.Name] = timesheetID
+}
+
+// Registry returns the attributes registry of d, creating it using
+// NewAttributeRegistry at first call if SetRegistry has not been
+// called before.
+func (d *Device) Registry() *AttributeRegistry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.registry == nil {
+		d.registry = NewAttributeRegistry()
+	}
+	return d.registry
+}
+
+// SetRegistry sets the attributes registry of d, allowing several
+// devices of the same model to share it.
+func (d *Device) SetRegistry(r *AttributeRegistry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.registry = r
+}
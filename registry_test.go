@@ -0,0 +1,90 @@
+package vitotrol
+
+import (
+	"sync"
+	"testing"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+func lookup(r *AttributeRegistry, name string) []interface{} {
+	attrID, ok := r.ID(name)
+	return []interface{}{attrID, ok}
+}
+
+func TestAttributeRegistry(tt *testing.T) {
+	t := td.NewT(tt)
+
+	r := NewAttributeRegistry()
+
+	// Seeded with the built-in catalog
+	t.Cmp(r.IDs(), td.Len(len(AttributesRef)))
+	t.Cmp(r.IDs(), td.Smuggle(func(ids []AttrID) bool {
+		for i := 1; i < len(ids); i++ {
+			if ids[i-1] >= ids[i] {
+				return false
+			}
+		}
+		return true
+	}, true))
+	for attrID, pRef := range AttributesRef {
+		t.Cmp(r.Ref(attrID), pRef)
+		t.Cmp(lookup(r, pRef.Name), []interface{}{attrID, true})
+	}
+
+	t.Nil(r.Ref(9876))
+	t.Cmp(lookup(r, "Unknown"), []interface{}{AttrID(0), false})
+
+	// Add
+	r.Add(9876, AttrRef{Type: TypeDouble, Access: ReadOnly, Name: "Foo"})
+	t.Cmp(r.Ref(9876), &AttrRef{Type: TypeDouble, Access: ReadOnly, Name: "Foo"})
+	t.Cmp(lookup(r, "Foo"), []interface{}{AttrID(9876), true})
+	t.Cmp(r.IDs(), td.Contains(AttrID(9876)))
+
+	// Replace, the old name is forgotten
+	r.Add(9876, AttrRef{Type: TypeInteger, Access: ReadWrite, Name: "Bar"})
+	t.Cmp(r.Ref(9876).Name, "Bar")
+	t.Cmp(lookup(r, "Bar"), []interface{}{AttrID(9876), true})
+	t.Cmp(lookup(r, "Foo"), []interface{}{AttrID(0), false})
+
+	// The built-in catalog is not altered
+	t.Cmp(AttributesRef, td.Not(td.ContainsKey(AttrID(9876))))
+
+	// Concurrent use
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r.Add(AttrID(10000+i), AttrRef{Type: TypeString, Name: "Concurrent"})
+			r.Ref(IndoorTemp)
+			r.ID("IndoorTemp")
+			r.IDs()
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestDeviceRegistry(tt *testing.T) {
+	t := td.NewT(tt)
+
+	var gas, heatPump Device
+
+	t.NotNil(gas.Registry())
+	t.Shallow(gas.Registry(), gas.Registry())
+	t.Not(heatPump.Registry(), td.Shallow(gas.Registry()))
+
+	// Each device has its own catalog
+	gas.Registry().Add(9876, AttrRef{Type: TypeDouble, Name: "GasFoo"})
+	heatPump.Registry().Add(9876, AttrRef{Type: TypeInteger, Name: "PumpFoo"})
+	t.Cmp(gas.Registry().Ref(9876).Name, "GasFoo")
+	t.Cmp(heatPump.Registry().Ref(9876).Name, "PumpFoo")
+
+	// Shared registry
+	r := NewAttributeRegistry()
+	gas.SetRegistry(r)
+	heatPump.SetRegistry(r)
+	t.Shallow(gas.Registry(), r)
+	t.Shallow(heatPump.Registry(), r)
+	t.Nil(gas.Registry().Ref(9876))
+}
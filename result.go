@@ -1,6 +1,7 @@
 package vitotrol
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -9,6 +10,8 @@ import (
 type ResultHeader struct {
 	ErrorNum int    `xml:"Ergebnis"`
 	ErrorStr string `xml:"ErgebnisText"`
+
+	err error // matched by Is, see Session.ResultErrors
 }
 
 // Error returns the result as a string.
@@ -22,6 +25,36 @@ func (e *ResultHeader) IsError() bool {
 	return e.ErrorNum != 0
 }
 
+// ResultOK is the result code returned by the Vitotrol™ server in
+// the Ergebnis field of successful responses.
+const ResultOK = 0
+
+// Is allows to match using errors.Is the error the result code is
+// mapped to by the ResultErrors of the session that received it.
+func (e *ResultHeader) Is(target error) bool {
+	return e.err != nil && e.err == target
+}
+
+// MatchResult returns a function reporting whether err is, or
+// wraps, a *ResultHeader with one of the result codes codes. It is
+// typically used with WithSessionExpiry, as in:
+//
+//	vitotrol.WithSessionExpiry(vitotrol.MatchResult(code))
+func MatchResult(codes ...int) func(err error) bool {
+	return func(err error) bool {
+		var result *ResultHeader
+		if !errors.As(err, &result) {
+			return false
+		}
+		for _, code := range codes {
+			if result.ErrorNum == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // HasResultHeader is the interface for abstrating Result part of each
 // Vitotrol™ Response message.
 type HasResultHeader interface {
@@ -1,6 +1,8 @@
 package vitotrol
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	td "github.com/maxatome/go-testdeep"
@@ -26,3 +28,29 @@ func TestResultHeader(tt *testing.T) {
 	t.CmpDeeply(rh.Error(), "Big error [#42]")
 	t.True(rh.IsError())
 }
+
+func TestResultHeaderIs(tt *testing.T) {
+	t := td.NewT(tt)
+
+	// Not mapped
+	t.False(errors.Is(&ResultHeader{ErrorNum: 42}, ErrSessionExpired))
+	t.False(errors.Is(&ResultHeader{}, ErrSessionExpired))
+
+	// Mapped by a session, see TestSendRequest
+	rh := &ResultHeader{ErrorNum: 42, err: ErrSessionExpired}
+	t.True(errors.Is(rh, ErrSessionExpired))
+	t.False(errors.Is(rh, ErrServerBusy))
+}
+
+func TestMatchResult(tt *testing.T) {
+	t := td.NewT(tt)
+
+	match := MatchResult(7, 8)
+	t.True(match(&ResultHeader{ErrorNum: 7}))
+	t.True(match(fmt.Errorf("wrapped: %w", &ResultHeader{ErrorNum: 8})))
+	t.False(match(&ResultHeader{ErrorNum: 9}))
+	t.False(match(&HTTPError{StatusCode: 7}))
+	t.False(match(nil))
+
+	t.False(MatchResult()(&ResultHeader{ErrorNum: 7}))
+}
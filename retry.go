@@ -0,0 +1,148 @@
+package vitotrol
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+// RetryPolicy defines how idempotent requests are retried when they
+// fail with a transient error. Only requests that do not modify the
+// device state are retried: Login, GetDevices, GetData,
+// GetErrorHistory, GetTimesheetData, GetTypeInfo,
+// RequestRefreshStatus and RequestWriteStatus. WriteData, RefreshData
+// and WriteTimesheetData are never retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the
+	// first one. 0 or 1 means no retry.
+	MaxAttempts int
+	// InitialBackoff is the pause duration before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff, if not 0, is the maximum pause duration between
+	// two attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor applied to the pause duration after
+	// each retry. Values lower than 1 are considered as 1.
+	Multiplier float64
+	// Jitter is the fraction of the pause duration randomly added or
+	// removed to it, between 0 and 1.
+	Jitter float64
+	// Retryable tells whether a failed request can be retried. If
+	// nil, IsTransient is used.
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy is a sensible retry policy, see WithRetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+var idempotentActions = map[string]bool{
+	"Login":                true,
+	"GetDevices":           true,
+	"GetData":              true,
+	"GetErrorHistory":      true,
+	"GetTimesheetData":     true,
+	"GetTypeInfo":          true,
+	"RequestRefreshStatus": true,
+	"RequestWriteStatus":   true,
+}
+
+// IsTransient returns true if err is a priori a temporary failure
+// that can disappear by retrying the same request later: server busy
+// results, HTTP 5xx statuses (except SOAP client faults), network
+// timeouts and unexpectedly closed connections.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, ErrServerBusy) {
+		return true
+	}
+
+	var fault *SOAPFault
+	if errors.As(err, &fault) && strings.Contains(fault.Code, "Client") {
+		return false
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTransient(err)
+}
+
+// backoff returns the pause duration before the retry number
+// retry (starting at 1).
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+
+	wait := float64(p.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		wait *= mult
+		if p.MaxBackoff > 0 && wait >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+
+	if p.Jitter > 0 {
+		wait += wait * p.Jitter * (2*rand.Float64() - 1) //nolint: gosec
+	}
+
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return time.Duration(wait)
+}
+
+// withRetry calls send until it succeeds, or fails with a non
+// retryable error, or the maximum number of attempts is reached, or
+// ctx is done. Only idempotent actions are retried.
+func (v *Session) withRetry(ctx context.Context, soapAction string, send func() error) error {
+	p := v.Retry
+	if p == nil || !idempotentActions[soapAction] {
+		return send()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil ||
+			attempt >= p.MaxAttempts ||
+			ctx.Err() != nil ||
+			!p.retryable(err) {
+			return err
+		}
+
+		if sleepContext(ctx, v.clock(), p.backoff(attempt)) != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package vitotrol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransient(tt *testing.T) {
+	t := td.NewT(tt)
+
+	t.False(IsTransient(nil))
+	t.False(IsTransient(errors.New("boom")))
+	t.False(IsTransient(&ResultHeader{ErrorNum: 7, err: ErrSessionExpired}))
+	t.True(IsTransient(&ResultHeader{ErrorNum: 99, err: ErrServerBusy}))
+	t.False(IsTransient(&ResultHeader{ErrorNum: 99}))
+	t.True(IsTransient(&HTTPError{StatusCode: 500}))
+	t.True(IsTransient(&HTTPError{StatusCode: 429}))
+	t.False(IsTransient(&HTTPError{StatusCode: 404}))
+	t.True(IsTransient(&SOAPFault{
+		Code:      "soap:Server",
+		httpError: &HTTPError{StatusCode: 500},
+	}))
+	t.False(IsTransient(&SOAPFault{
+		Code:      "soap:Client",
+		httpError: &HTTPError{StatusCode: 500},
+	}))
+	t.True(IsTransient(fmt.Errorf("wrapped: %w", timeoutError{})))
+	t.True(IsTransient(io.ErrUnexpectedEOF))
+}
+
+func TestRetryPolicyBackoff(tt *testing.T) {
+	t := td.NewT(tt)
+
+	p := RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+	}
+	t.CmpDeeply(p.backoff(1), time.Second)
+	t.CmpDeeply(p.backoff(2), 2*time.Second)
+	t.CmpDeeply(p.backoff(3), 4*time.Second)
+	t.CmpDeeply(p.backoff(4), 5*time.Second)
+	t.CmpDeeply(p.backoff(100), 5*time.Second)
+
+	p.Multiplier = 0
+	t.CmpDeeply(p.backoff(3), time.Second)
+
+	p.Multiplier = 2
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		t.CmpDeeply(p.backoff(2), td.Between(time.Second, 3*time.Second))
+	}
+}
+
+func TestRetry(tt *testing.T) {
+	t := td.NewT(tt)
+
+	var actions []string
+	failures := 0
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			soapActionURL := r.Header.Get("SOAPAction")
+			action := soapActionURL[strings.LastIndex(soapActionURL, "/")+1:]
+			actions = append(actions, action)
+
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintln(w, respHeader+intoDeviceResponse(action,
+				`<Ergebnis>0</Ergebnis><ErgebnisText>Kein Fehler</ErgebnisText>`)+
+				respFooter)
+		}))
+	defer ts.Close()
+
+	v := NewSession(
+		WithEndpoint(ts.URL),
+		WithRetryPolicy(RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+		}))
+	d := &Device{
+		Attributes: map[AttrID]*Value{},
+		Timesheets: map[TimesheetID]map[string]TimeslotSlice{},
+	}
+
+	// Retried until success
+	failures = 2
+	t.CmpNoError(v.GetDevices())
+	t.CmpDeeply(actions, []string{"GetDevices", "GetDevices", "GetDevices"})
+
+	// Too many failures
+	actions, failures = nil, 3
+	t.CmpErrorIs(v.GetDevices(), ErrServerBusy)
+	t.Len(actions, 3)
+
+	// Non idempotent request is never retried
+	actions, failures = nil, 1
+	_, err := d.WriteData(v, BoilerTemp, "1")
+	t.CmpErrorIs(err, ErrServerBusy)
+	t.CmpDeeply(actions, []string{"WriteData"})
+
+	// Non retryable error
+	v.Retry.Retryable = func(error) bool { return false }
+	actions, failures = nil, 1
+	t.CmpErrorIs(v.GetDevices(), ErrServerBusy)
+	t.Len(actions, 1)
+
+	// Context canceled during backoff
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := &stubClock{hold: true, onTimer: cancel}
+	v.Clock = clock
+	v.Retry.Retryable = nil
+	v.Retry.InitialBackoff = time.Hour
+	actions, failures = nil, 1
+	t.CmpErrorIs(v.GetDevicesContext(ctx), ErrServerBusy)
+	t.Len(actions, 1)
+	t.CmpDeeply(clock.waits, []time.Duration{time.Hour})
+	t.CmpDeeply(clock.stopped, 1, "backoff timer stopped")
+}
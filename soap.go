@@ -0,0 +1,63 @@
+package vitotrol
+
+import (
+	"encoding/xml"
+)
+
+const (
+	xmlnsXSI  = "http://www.w3.org/2001/XMLSchema-instance"
+	xmlnsXSD  = "http://www.w3.org/2001/XMLSchema"
+	xmlnsSOAP = "http://schemas.xmlsoap.org/soap/envelope/"
+)
+
+// soapEnvelope is the SOAP 1.1 envelope wrapping each request sent
+// to the Vitotrol™ server.
+type soapEnvelope struct {
+	XMLName   xml.Name `xml:"soap:Envelope"`
+	XSI       string   `xml:"xmlns:xsi,attr"`
+	XSD       string   `xml:"xmlns:xsd,attr"`
+	SOAP      string   `xml:"xmlns:soap,attr"`
+	Namespace string   `xml:"xmlns,attr"`
+	Body      struct {
+		Request interface{}
+	} `xml:"soap:Body"`
+}
+
+// marshalRequest returns the XML SOAP envelope containing request,
+// using the default namespace namespace. request must be a struct
+// (or a pointer to a struct) with a XMLName field naming the SOAP
+// action.
+func marshalRequest(namespace string, request interface{}) ([]byte, error) {
+	envelope := soapEnvelope{
+		XSI:       xmlnsXSI,
+		XSD:       xmlnsXSD,
+		SOAP:      xmlnsSOAP,
+		Namespace: namespace,
+	}
+	envelope.Body.Request = request
+
+	body, err := xml.Marshal(&envelope)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// deviceRequest is the common part of all requests targeting a
+// device.
+type deviceRequest struct {
+	DeviceID   uint32 `xml:"GeraetId"`
+	LocationID uint32 `xml:"AnlageId"`
+}
+
+// deviceRequest returns the common part of all requests targeting d.
+func (d *Device) deviceRequest() deviceRequest {
+	return deviceRequest{
+		DeviceID:   d.DeviceID,
+		LocationID: d.LocationID,
+	}
+}
+
+func (r deviceRequest) device() deviceRequest {
+	return r
+}
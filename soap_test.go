@@ -0,0 +1,75 @@
+package vitotrol
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+func TestMarshalRequest(tt *testing.T) {
+	t := td.NewT(tt)
+
+	body, err := marshalRequest("http://www/", &loginRequest{
+		AppID:      "prod",
+		AppVersion: "4.3.1",
+		Password:   `a<b&c"d`,
+		System:     "Android",
+		Login:      "me&you",
+	})
+	if !t.CmpNoError(err) {
+		return
+	}
+
+	t.True(strings.HasPrefix(string(body), xml.Header))
+	t.Contains(string(body), `<Passwort>a&lt;b&amp;c&#34;d</Passwort>`)
+	t.Contains(string(body), `<Benutzer>me&amp;you</Benutzer>`)
+
+	// Special characters round trip
+	var got struct {
+		Password string `xml:"Body>Login>Passwort"`
+		Login    string `xml:"Body>Login>Benutzer"`
+	}
+	if t.CmpNoError(xml.Unmarshal(body, &got)) {
+		t.CmpDeeply(got.Password, `a<b&c"d`)
+		t.CmpDeeply(got.Login, "me&you")
+	}
+
+	// Namespace
+	var envelope struct {
+		XMLName xml.Name
+		Body    struct {
+			Login struct {
+				XMLName xml.Name
+			} `xml:"Login"`
+		} `xml:"Body"`
+	}
+	if t.CmpNoError(xml.Unmarshal(body, &envelope)) {
+		t.CmpDeeply(envelope.XMLName,
+			xml.Name{Space: xmlnsSOAP, Local: "Envelope"})
+		t.CmpDeeply(envelope.Body.Login.XMLName,
+			xml.Name{Space: "http://www/", Local: "Login"})
+	}
+
+	// Not a struct
+	_, err = marshalRequest("http://www/", make(chan int))
+	t.CmpError(err)
+}
+
+func TestMarshalDeviceRequest(tt *testing.T) {
+	t := td.NewT(tt)
+
+	d := &Device{DeviceID: 12, LocationID: 34}
+
+	body, err := marshalRequest("http://www/", &getDataRequest{
+		deviceRequest: d.deviceRequest(),
+		IDs:           []AttrID{11, 22},
+	})
+	if t.CmpNoError(err) {
+		t.Contains(string(body),
+			`<GetData><GeraetId>12</GeraetId><AnlageId>34</AnlageId>`+
+				`<DatenpunktIds><int>11</int><int>22</int></DatenpunktIds>`+
+				`</GetData>`)
+	}
+}
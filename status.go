@@ -0,0 +1,123 @@
+package vitotrol
+
+import (
+	"context"
+	"fmt"
+)
+
+// AsyncStatus is the status of an asynchronous operation, as returned
+// by RequestRefreshStatus or RequestWriteStatus.
+type AsyncStatus interface {
+	fmt.Stringer
+	// IsFinal returns true if the operation is over.
+	IsFinal() bool
+	// IsSuccess returns true if the operation is over and succeeded.
+	IsSuccess() bool
+}
+
+// RefreshStatus is the status of a RefreshData operation, as
+// returned by RequestRefreshStatus.
+type RefreshStatus int
+
+// Known RefreshStatus values. Any status >= RefreshDone is final,
+// any other final status than RefreshDone is a failure.
+const (
+	RefreshPending    RefreshStatus = 1
+	RefreshInProgress RefreshStatus = 3
+	RefreshDone       RefreshStatus = 4
+)
+
+var _ AsyncStatus = RefreshStatus(0)
+
+// String returns the status as a string.
+func (s RefreshStatus) String() string {
+	switch s {
+	case RefreshPending:
+		return "pending"
+	case RefreshInProgress:
+		return "in progress"
+	case RefreshDone:
+		return "done"
+	}
+	return fmt.Sprintf("status#%d", int(s))
+}
+
+// IsFinal returns true if the refresh is over.
+func (s RefreshStatus) IsFinal() bool {
+	return s >= RefreshDone
+}
+
+// IsSuccess returns true if the refresh is over and succeeded.
+func (s RefreshStatus) IsSuccess() bool {
+	return s == RefreshDone
+}
+
+// WriteStatus is the status of a WriteData or WriteTimesheetData
+// operation, as returned by RequestWriteStatus.
+type WriteStatus int
+
+// Known WriteStatus values. Any status >= WriteDone is final, any
+// other final status than WriteDone and WriteDoneDateTime is a
+// failure.
+const (
+	WritePending    WriteStatus = 1
+	WriteInProgress WriteStatus = 3
+	WriteDone       WriteStatus = 4
+	// WriteDoneDateTime is returned on success when setting the date
+	// and time of a device.
+	WriteDoneDateTime WriteStatus = 9
+)
+
+var _ AsyncStatus = WriteStatus(0)
+
+// String returns the status as a string.
+func (s WriteStatus) String() string {
+	switch s {
+	case WritePending:
+		return "pending"
+	case WriteInProgress:
+		return "in progress"
+	case WriteDone, WriteDoneDateTime:
+		return "done"
+	}
+	return fmt.Sprintf("status#%d", int(s))
+}
+
+// IsFinal returns true if the write is over.
+func (s WriteStatus) IsFinal() bool {
+	return s >= WriteDone
+}
+
+// IsSuccess returns true if the write is over and succeeded.
+func (s WriteStatus) IsSuccess() bool {
+	return s == WriteDone || s == WriteDoneDateTime
+}
+
+// UnexpectedStatusError is returned when an asynchronous operation
+// ends with a final status that is not a success one.
+type UnexpectedStatusError struct {
+	Status AsyncStatus
+}
+
+// Error returns the error as a string.
+func (e *UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("Unexpected status %d", e.Status)
+}
+
+// isPendingStatus returns true if status is a well known not final
+// one.
+func isPendingStatus(status AsyncStatus) bool {
+	switch status {
+	case RefreshPending, RefreshInProgress, WritePending, WriteInProgress:
+		return true
+	}
+	return false
+}
+
+func asyncRefreshStatus(ctx context.Context, v *Session, refreshID string) (AsyncStatus, error) {
+	return v.RequestRefreshStatusContext(ctx, refreshID)
+}
+
+func asyncWriteStatus(ctx context.Context, v *Session, refreshID string) (AsyncStatus, error) {
+	return v.RequestWriteStatusContext(ctx, refreshID)
+}
@@ -0,0 +1,64 @@
+package vitotrol
+
+import (
+	"errors"
+	"testing"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+func TestRefreshStatus(tt *testing.T) {
+	t := td.NewT(tt)
+
+	for _, tc := range []struct {
+		status    RefreshStatus
+		str       string
+		isFinal   bool
+		isSuccess bool
+	}{
+		{status: RefreshPending, str: "pending"},
+		{status: 2, str: "status#2"},
+		{status: RefreshInProgress, str: "in progress"},
+		{status: RefreshDone, str: "done", isFinal: true, isSuccess: true},
+		{status: 5, str: "status#5", isFinal: true},
+		{status: 9, str: "status#9", isFinal: true},
+	} {
+		t.Cmp(tc.status.String(), tc.str, "status %d", tc.status)
+		t.Cmp(tc.status.IsFinal(), tc.isFinal, "status %d", tc.status)
+		t.Cmp(tc.status.IsSuccess(), tc.isSuccess, "status %d", tc.status)
+	}
+}
+
+func TestWriteStatus(tt *testing.T) {
+	t := td.NewT(tt)
+
+	for _, tc := range []struct {
+		status    WriteStatus
+		str       string
+		isFinal   bool
+		isSuccess bool
+	}{
+		{status: WritePending, str: "pending"},
+		{status: 2, str: "status#2"},
+		{status: WriteInProgress, str: "in progress"},
+		{status: WriteDone, str: "done", isFinal: true, isSuccess: true},
+		{status: 5, str: "status#5", isFinal: true},
+		{status: WriteDoneDateTime, str: "done", isFinal: true, isSuccess: true},
+	} {
+		t.Cmp(tc.status.String(), tc.str, "status %d", tc.status)
+		t.Cmp(tc.status.IsFinal(), tc.isFinal, "status %d", tc.status)
+		t.Cmp(tc.status.IsSuccess(), tc.isSuccess, "status %d", tc.status)
+	}
+}
+
+func TestUnexpectedStatusError(tt *testing.T) {
+	t := td.NewT(tt)
+
+	var err error = &UnexpectedStatusError{Status: WriteStatus(5)}
+	t.Cmp(err.Error(), "Unexpected status 5")
+
+	var use *UnexpectedStatusError
+	if t.True(errors.As(err, &use)) {
+		t.Cmp(use.Status, WriteStatus(5))
+	}
+}
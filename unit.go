@@ -0,0 +1,153 @@
+package vitotrol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Unit is the unit of the values of an attribute.
+type Unit string
+
+// Known units. Temperatures can be converted from one unit to
+// another, see ConvertUnit.
+const (
+	UnitNone       Unit = ""
+	UnitCelsius    Unit = "°C"
+	UnitFahrenheit Unit = "°F"
+	UnitKelvin     Unit = "K"
+	UnitHours      Unit = "h"
+	UnitStarts     Unit = "starts"
+	UnitPercent    Unit = "%"
+)
+
+// ErrIncompatibleUnits is returned when converting a value between
+// two units measuring different quantities, as °C and hours.
+var ErrIncompatibleUnits = errors.New("Incompatible units")
+
+// unitAliases maps the suffixes accepted by ParseUnitValue to their
+// unit, longest first.
+var unitAliases = []struct {
+	suffix string
+	unit   Unit
+}{
+	{"starts", UnitStarts},
+	{"°C", UnitCelsius},
+	{"°F", UnitFahrenheit},
+	{"C", UnitCelsius},
+	{"F", UnitFahrenheit},
+	{"K", UnitKelvin},
+	{"h", UnitHours},
+	{"%", UnitPercent},
+}
+
+// isTemperature returns true if u is a temperature unit.
+func (u Unit) isTemperature() bool {
+	return u == UnitCelsius || u == UnitFahrenheit || u == UnitKelvin
+}
+
+// ConvertUnit converts value from unit from to unit to. Only
+// temperatures can be converted between different units, otherwise
+// ErrIncompatibleUnits is returned.
+func ConvertUnit(value float64, from, to Unit) (float64, error) {
+	if from == to {
+		return value, nil
+	}
+	if !from.isTemperature() || !to.isTemperature() {
+		return 0, fmt.Errorf("%w: %q to %q", ErrIncompatibleUnits, from, to)
+	}
+
+	// To Celsius
+	switch from {
+	case UnitFahrenheit:
+		value = (value - 32) * 5 / 9
+	case UnitKelvin:
+		value -= 273.15
+	}
+
+	// From Celsius
+	switch to {
+	case UnitFahrenheit:
+		value = value*9/5 + 32
+	case UnitKelvin:
+		value += 273.15
+	}
+	return value, nil
+}
+
+// ParseUnitValue splits value into a number and its unit suffix, as
+// in "72F", "72 °F", "295.15K" or "21,5°C". false is returned if
+// value is not a number followed by a known unit.
+func ParseUnitValue(value string) (float64, Unit, bool) {
+	value = strings.TrimSpace(value)
+	for _, alias := range unitAliases {
+		if !strings.HasSuffix(value, alias.suffix) {
+			continue
+		}
+		num := strings.TrimSpace(strings.TrimSuffix(value, alias.suffix))
+		f, err := strconv.ParseFloat(strings.Replace(num, ",", ".", 1), 64)
+		if err == nil {
+			return f, alias.unit, true
+		}
+	}
+	return 0, UnitNone, false
+}
+
+// ConvertValue returns the Vitodata™ value of the attribute described
+// by r converted to unit. The attribute must be numeric and have a
+// unit compatible with unit.
+func (r *AttrRef) ConvertValue(value string, unit Unit) (float64, error) {
+	native, err := r.Type.Vitodata2NativeValue(value)
+	if err != nil {
+		return 0, err
+	}
+
+	var num float64
+	switch native := native.(type) {
+	case float64:
+		num = native
+	case int64:
+		num = float64(native)
+	default:
+		return 0, fmt.Errorf("Attribute %s is not numeric", r.Name)
+	}
+	return ConvertUnit(num, r.Unit, unit)
+}
+
+// Human2VitodataValue is the same as r.Type.Human2VitodataValue, but
+// the value of a numeric attribute having a unit can be suffixed by a
+// unit, as "72F" for a °C attribute, in which case it is first
+// converted to the unit of the attribute. The converted value is
+// rounded to the nearest Min + N × Step of the attribute Range, or to
+// one decimal if it has no step, then to an integer for TypeInteger
+// attributes. Values of other attributes are passed unchanged to
+// r.Type.Human2VitodataValue.
+func (r *AttrRef) Human2VitodataValue(value string) (string, error) {
+	if r.Unit == UnitNone || (r.Type != TypeDouble && r.Type != TypeInteger) {
+		return r.Type.Human2VitodataValue(value)
+	}
+
+	num, unit, ok := ParseUnitValue(value)
+	if ok && unit != r.Unit {
+		converted, err := ConvertUnit(num, unit, r.Unit)
+		if err != nil {
+			return "", err
+		}
+
+		base, step := 0.0, 0.1
+		if r.Range != nil && r.Range.Step != 0 {
+			base, step = r.Range.Min, r.Range.Step
+		}
+		converted = base + math.Round((converted-base)/step)*step
+		if r.Type == TypeInteger {
+			converted = math.Round(converted)
+		}
+		converted = math.Round(converted*1e9) / 1e9 // float noise
+		value = strconv.FormatFloat(converted, 'f', -1, 64)
+	} else if ok {
+		value = strconv.FormatFloat(num, 'f', -1, 64)
+	}
+	return r.Type.Human2VitodataValue(value)
+}
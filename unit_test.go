@@ -0,0 +1,145 @@
+package vitotrol
+
+import (
+	"math"
+	"testing"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+func TestConvertUnit(tt *testing.T) {
+	t := td.NewT(tt)
+
+	for _, test := range []struct {
+		value    float64
+		from, to Unit
+		expected float64
+	}{
+		{value: 21.5, from: UnitCelsius, to: UnitCelsius, expected: 21.5},
+		{value: 100, from: UnitCelsius, to: UnitFahrenheit, expected: 212},
+		{value: -40, from: UnitFahrenheit, to: UnitCelsius, expected: -40},
+		{value: 0, from: UnitCelsius, to: UnitKelvin, expected: 273.15},
+		{value: 273.15, from: UnitKelvin, to: UnitFahrenheit, expected: 32},
+		{value: 12, from: UnitHours, to: UnitHours, expected: 12},
+	} {
+		got, err := ConvertUnit(test.value, test.from, test.to)
+		t.CmpNoError(err)
+		t.Cmp(got, td.Between(test.expected-1e-9, test.expected+1e-9),
+			"%g %s → %s", test.value, test.from, test.to)
+	}
+
+	_, err := ConvertUnit(12, UnitHours, UnitCelsius)
+	t.CmpErrorIs(err, ErrIncompatibleUnits)
+	_, err = ConvertUnit(12, UnitNone, UnitPercent)
+	t.CmpErrorIs(err, ErrIncompatibleUnits)
+}
+
+func TestParseUnitValue(tt *testing.T) {
+	t := td.NewT(tt)
+
+	for value, expected := range map[string][]interface{}{
+		"72F":        {72.0, UnitFahrenheit, true},
+		"72 °F":      {72.0, UnitFahrenheit, true},
+		"21,5°C":     {21.5, UnitCelsius, true},
+		"-3C":        {-3.0, UnitCelsius, true},
+		" 295.15K ":  {295.15, UnitKelvin, true},
+		"12h":        {12.0, UnitHours, true},
+		"42%":        {42.0, UnitPercent, true},
+		"1234starts": {1234.0, UnitStarts, true},
+		"21":         {0.0, UnitNone, false},
+		"on":         {0.0, UnitNone, false},
+		"F":          {0.0, UnitNone, false},
+	} {
+		num, unit, ok := ParseUnitValue(value)
+		t.Cmp([]interface{}{num, unit, ok}, expected, "%q", value)
+	}
+}
+
+func TestAttrRefUnit(tt *testing.T) {
+	t := td.NewT(tt)
+
+	t.String(AttributesRef[BoilerTemp],
+		"BoilerTemp: Boiler temperature (Double °C - read-only)")
+
+	// Reading
+	f, err := AttributesRef[BoilerTemp].ConvertValue("54,5", UnitFahrenheit)
+	t.CmpNoError(err)
+	t.Cmp(math.Round(f*10)/10, 130.1)
+
+	f, err = AttributesRef[BoilerTemp].ConvertValue("54,5", UnitCelsius)
+	t.CmpNoError(err)
+	t.Cmp(f, 54.5)
+
+	_, err = AttributesRef[BurnerHoursRun].ConvertValue("12", UnitKelvin)
+	t.CmpErrorIs(err, ErrIncompatibleUnits)
+	_, err = AttributesRef[PartyMode].ConvertValue("1", UnitCelsius)
+	t.String(err, "Attribute PartyMode is not numeric")
+	_, err = AttributesRef[BoilerTemp].ConvertValue("abc", UnitCelsius)
+	t.CmpError(err)
+
+	// Writing
+	for _, test := range []struct {
+		attrID   AttrID
+		value    string
+		expected string
+	}{
+		{attrID: HeatNormalTemp, value: "21", expected: "21"},
+		{attrID: HeatNormalTemp, value: "21°C", expected: "21"},
+		{attrID: HeatNormalTemp, value: "72F", expected: "22,2"},
+		{attrID: HeatNormalTemp, value: "295.15K", expected: "22"},
+		{attrID: HotWaterSetpointTemp, value: "140°F", expected: "60"},
+		{attrID: BoilerTemp, value: "72F", expected: "22,2"},
+		{attrID: BoilerTemp, value: "21,5°C", expected: "21,5"},
+		{attrID: PartyMode, value: "enabled", expected: "1"},
+	} {
+		got, err := AttributesRef[test.attrID].Human2VitodataValue(test.value)
+		t.CmpNoError(err, "%d %q", test.attrID, test.value)
+		t.Cmp(got, test.expected, "%d %q", test.attrID, test.value)
+	}
+
+	// Rounded to the step of the range
+	steppedRef := AttrRef{
+		Name:  "Stepped",
+		Type:  TypeDouble,
+		Range: &AttrRange{Min: 3, Max: 37, Step: 0.5},
+		Unit:  UnitCelsius,
+	}
+	got, err := steppedRef.Human2VitodataValue("72F")
+	t.CmpNoError(err)
+	t.Cmp(got, "22")
+
+	// Steps are relative to the range min
+	steppedRef.Range = &AttrRange{Min: 0.2, Max: 37, Step: 0.5}
+	got, err = steppedRef.Human2VitodataValue("72F")
+	t.CmpNoError(err)
+	t.Cmp(got, "22,2")
+
+	// Integer attributes get integer values
+	integerRef := AttrRef{Name: "Integer", Type: TypeInteger, Unit: UnitCelsius}
+	got, err = integerRef.Human2VitodataValue("72F")
+	t.CmpNoError(err)
+	t.Cmp(got, "22")
+	integerRef.Range = &AttrRange{Min: 0, Max: 100, Step: 5}
+	got, err = integerRef.Human2VitodataValue("72F")
+	t.CmpNoError(err)
+	t.Cmp(got, "20")
+
+	_, err = AttributesRef[HeatNormalTemp].Human2VitodataValue("12h")
+	t.CmpErrorIs(err, ErrIncompatibleUnits)
+	_, err = AttributesRef[HeatNormalTemp].Human2VitodataValue("abc")
+	t.CmpError(err)
+
+	// Unit-like values of attributes without unit are left untouched
+	enumRef := AttrRef{Name: "Enum", Type: NewEnum([]string{"0%", "30%", "12h"})}
+	got, err = enumRef.Human2VitodataValue("30%")
+	t.CmpNoError(err)
+	t.Cmp(got, "1")
+	got, err = enumRef.Human2VitodataValue("12h")
+	t.CmpNoError(err)
+	t.Cmp(got, "2")
+
+	stringRef := AttrRef{Name: "String", Type: TypeString}
+	got, err = stringRef.Human2VitodataValue("2K")
+	t.CmpNoError(err)
+	t.Cmp(got, "2K")
+}
@@ -0,0 +1,102 @@
+package vitotrol
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// WriteMismatchError is returned by a verified write when the value
+// read back from the boiler differs from the written one, see
+// WithVerify.
+type WriteMismatchError struct {
+	AttrID   AttrID
+	Name     string // name of the attribute in the registry of the device
+	Expected string // written value
+	Actual   string // value read back
+}
+
+// Error returns the mismatch as a string.
+func (e *WriteMismatchError) Error() string {
+	return fmt.Sprintf("Write mismatch for %s: wrote `%s' but read back `%s'",
+		e.Name, e.Expected, e.Actual)
+}
+
+// WithVerify enables or disables the read back of the value written
+// by a WriteData operation, overriding Session.VerifyWrites. Once
+// the write succeeded, the attribute is refreshed then got, updating
+// Device.Attributes, and the operation fails with a
+// *WriteMismatchError if the boiler reports another value. Values
+// are compared after their conversion using the VitodataType of the
+// attribute in the registry of the device, so "20,0" matches "20"
+// for a Double. It is ignored by other operations.
+func WithVerify(verify bool) OperationOption {
+	return func(o *Operation) {
+		o.verify = &verify
+	}
+}
+
+// WithVerifiedWrites makes all the WriteData operations of the
+// session read back the written value. See Session.VerifyWrites.
+func WithVerifiedWrites() Option {
+	return func(v *Session) {
+		v.VerifyWrites = true
+	}
+}
+
+// verifyWrite returns true if the value written by op has to be read
+// back.
+func (v *Session) verifyWrite(op *Operation) bool {
+	if op.verify != nil {
+		return *op.verify
+	}
+	return v.VerifyWrites
+}
+
+// checkWrite reads back attrID once op succeeded and checks its value
+// is value.
+func (d *Device) checkWrite(ctx context.Context, v *Session, op *Operation, attrID AttrID, value string) error {
+	var options []OperationOption
+	if op.wait != nil {
+		options = append(options, WithWait(*op.wait))
+	}
+
+	refresh, err := d.StartRefreshData(ctx, v, []AttrID{attrID}, options...)
+	if err != nil {
+		return err
+	}
+	if err = refresh.Wait(ctx); err != nil {
+		return err
+	}
+
+	if err = d.GetDataContext(ctx, v, []AttrID{attrID}); err != nil {
+		return err
+	}
+
+	actual, _ := d.Attribute(attrID)
+	registry := d.Registry()
+	if !sameValue(registry.Ref(attrID), value, actual.Value) {
+		return &WriteMismatchError{
+			AttrID:   attrID,
+			Name:     registry.name(attrID),
+			Expected: value,
+			Actual:   actual.Value,
+		}
+	}
+	return nil
+}
+
+// sameValue returns true if the Vitodata™ values a and b of the
+// attribute described by ref are the same, once converted using its
+// VitodataType. If ref is nil, values are compared as strings.
+func sameValue(ref *AttrRef, a, b string) bool {
+	if ref != nil {
+		nativeA, errA := ref.Type.Vitodata2NativeValue(a)
+		nativeB, errB := ref.Type.Vitodata2NativeValue(b)
+		if errA == nil && errB == nil {
+			return reflect.DeepEqual(nativeA, nativeB)
+		}
+	}
+	return strings.TrimSpace(a) == strings.TrimSpace(b)
+}
@@ -0,0 +1,66 @@
+package vitotrol_test
+
+import (
+	"context"
+	"testing"
+
+	td "github.com/maxatome/go-testdeep"
+
+	"github.com/maxatome/go-vitotrol"
+	"github.com/maxatome/go-vitotrol/vitotroltest"
+)
+
+func TestVerifyWrites(tt *testing.T) {
+	t := td.NewT(tt)
+
+	fake := vitotroltest.New()
+	dev := fake.AddAccount("pipo", "bingo").
+		AddLocation(12, "Home").
+		AddDevice(34, "Boiler")
+	v, d := vitotroltest.NewSessionWithDevice(t, fake, "pipo", "bingo", dev,
+		vitotrol.WithDefaultWait(vitotrol.WaitConfig{First: -1, Min: -1}),
+		vitotrol.WithVerifiedWrites())
+	dev.SetValue(vitotrol.HeatNormalTemp, "20,0")
+
+	heatNormalTemp := func() string {
+		value, _ := d.Attribute(vitotrol.HeatNormalTemp)
+		return value.Value
+	}
+	write := func(value string, options ...vitotrol.OperationOption) error {
+		op, err := d.StartWriteData(context.Background(), v,
+			vitotrol.HeatNormalTemp, value, options...)
+		if err != nil {
+			return err
+		}
+		return op.Wait(context.Background())
+	}
+
+	// Value taken
+	t.CmpNoError(write("21,5"))
+	t.Cmp(heatNormalTemp(), "21,5")
+
+	// Value not taken
+	dev.SetIgnoreWrites(true)
+	t.Cmp(write("22"), &vitotrol.WriteMismatchError{
+		AttrID:   vitotrol.HeatNormalTemp,
+		Name:     "HeatNormalTemp",
+		Expected: "22",
+		Actual:   "21,5",
+	})
+	t.Cmp(heatNormalTemp(), "21,5")
+
+	// Values are normalized before being compared
+	t.CmpNoError(write("21.50"))
+
+	// Verification disabled for this operation
+	t.CmpNoError(write("22", vitotrol.WithVerify(false)))
+
+	// Verification enabled for this operation only
+	v.VerifyWrites = false
+	ch, err := d.WriteDataWait(v, vitotrol.HeatNormalTemp, "22")
+	t.CmpNoError(err)
+	t.CmpNoError(<-ch)
+	err = write("22", vitotrol.WithVerify(true))
+	t.Cmp(err, td.Isa(&vitotrol.WriteMismatchError{}))
+	t.String(err, "Write mismatch for HeatNormalTemp: wrote `22' but read back `21,5'")
+}
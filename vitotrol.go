@@ -2,70 +2,361 @@ package vitotrol
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
-	"fmt"
+	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"reflect"
 	"sort"
+	"sync"
+	"time"
 )
 
-// MainURL is the Viessmann Vitodata API URL.
-var MainURL = `https://www.viessmann.com/app_vitodata/VIIWebService-1.16.0.0/iPhoneWebService.asmx`
+// DefaultServiceVersion is the version of the Viessmann Vitodata
+// API used by default.
+const DefaultServiceVersion = "1.16.0.0"
 
-const (
-	soapURL = `http://www.e-controlnet.de/services/vii/`
+// ServiceURL returns the Viessmann Vitodata API URL corresponding to
+// the passed service version.
+func ServiceURL(version string) string {
+	return "https://www.viessmann.com/app_vitodata/VIIWebService-" +
+		version + "/iPhoneWebService.asmx"
+}
 
-	reqHeader = `<?xml version="1.0" encoding="UTF-8"?><soap:Envelope xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns="` + soapURL + `">
-<soap:Body>
-`
-	reqFooter = `
-</soap:Body>
-</soap:Envelope>`
-)
+// MainURL is the Viessmann Vitodata API URL. It is the default
+// endpoint of sessions, see WithEndpoint option to override it per
+// session.
+var MainURL = ServiceURL(DefaultServiceVersion)
+
+const soapURL = `http://www.e-controlnet.de/services/vii/`
+
+// DefaultHTTPTimeout is the timeout of DefaultHTTPClient and of the
+// HTTP clients built on the fly from Session.Transport.
+const DefaultHTTPTimeout = 60 * time.Second
+
+// DefaultHTTPClient is the HTTP client shared by all sessions without
+// HTTPClient nor Transport. It keeps connections alive between
+// requests and bounds each of them to DefaultHTTPTimeout.
+var DefaultHTTPClient = &http.Client{
+	Timeout:   DefaultHTTPTimeout,
+	Transport: http.DefaultTransport.(*http.Transport).Clone(),
+}
 
 // Session keep a cache of all informations downloaded from the
 // Vitotrol™ server. See Login method as entry point.
+//
+// A zero Session is ready to use with default settings. Use
+// NewSession to customize it.
+//
+// A Session is safe for concurrent use by multiple goroutines as long
+// as its exported fields are not directly accessed. Use
+// CookiesSnapshot and DevicesList instead. A Session must not be
+// copied after first use.
 type Session struct {
 	Cookies []string
 
-	Devices []Device
+	// Devices lists the devices of the session, sorted by location
+	// then device IDs. Each *Device is allocated once by GetDevices
+	// and reused by next calls, so it stays valid for the whole life
+	// of the session.
+	Devices []*Device
 
+	// Debug, if true and Logger is nil, makes the session log at debug
+	// level to the standard logger.
 	Debug bool
+
+	// Logger, if not nil, receives a record for each SOAP request
+	// sent, with the action, the targeted device, the duration, the
+	// HTTP status and the result code. Requests and responses bodies
+	// are dumped at debug level, passwords and cookies redacted.
+	Logger *slog.Logger
+
+	// HTTPClient is the HTTP client used to send requests. If nil, a
+	// client using Transport is used, or DefaultHTTPClient if
+	// Transport is nil too.
+	HTTPClient *http.Client
+	// Transport is the HTTP transport used to send requests when
+	// HTTPClient is nil. Requests are then bounded to
+	// DefaultHTTPTimeout.
+	Transport http.RoundTripper
+
+	// OnRelogin, if not nil, is called each time the session is
+	// automatically re-authenticated after its expiration, with the
+	// error of this new login (nil if it succeeded). Note that the
+	// expiration is never detected, and so OnRelogin never called,
+	// unless SessionExpired or ResultErrors is set.
+	OnRelogin func(err error)
+
+	// ResultErrors maps the result codes of the Vitotrol™ server to
+	// the errors the *ResultHeader errors returned by the session
+	// match using errors.Is. The automatic re-login and the retry
+	// policy rely on it to detect ErrSessionExpired and
+	// ErrServerBusy. As Viessmann does not document the error codes,
+	// it is empty by default: result errors then match none of the
+	// errors of this package. See WithResultErrors.
+	ResultErrors map[int]error
+
+	// SessionExpired, if not nil, reports whether err, returned by a
+	// request, means that the session is not (or no longer) logged
+	// in, so it has to be automatically re-authenticated. By default,
+	// errors matching ErrSessionExpired are considered, which requires
+	// the corresponding code to be registered in ResultErrors. If
+	// neither is set, the automatic re-login is disabled.
+	SessionExpired func(err error) bool
+
+	// Retry, if not nil, is the policy applied to idempotent requests
+	// failing with a transient error.
+	Retry *RetryPolicy
+
+	// RateLimiter, if not nil, throttles the HTTP requests sent by the
+	// session, including the retried ones and the ones done while
+	// waiting for an asynchronous operation.
+	RateLimiter RateLimiter
+
+	// SerializeRequests, if true, ensures that at most one HTTP request
+	// at a time is in flight for the session, whatever the number of
+	// goroutines using it.
+	SerializeRequests bool
+
+	// Wait, if not nil, configures the polling of the status of all
+	// asynchronous operations of the session. Its zero fields take
+	// the defaults of each kind of operation, as WriteDataWaitDuration
+	// or RefreshDataWaitTimeout. It can be overridden per operation
+	// using WithWait.
+	Wait *WaitConfig
+
+	// Clock, if not nil, is the source of time used to poll
+	// asynchronous operations, check their timeouts, compute retry
+	// backoffs and throttle requests using a TokenBucket. SystemClock
+	// is used by default.
+	Clock Clock
+
+	// VerifyWrites, if true, makes each successful WriteData
+	// operation read back the written attribute, failing with a
+	// *WriteMismatchError if the boiler did not take the value. It can
+	// be overridden per operation using WithVerify.
+	VerifyWrites bool
+
+	endpoint    string
+	namespace   string
+	credentials CredentialsProvider
+
+	mu       sync.Mutex    // protects Cookies, Devices, credentials, loginGen & serial
+	serial   chan struct{} // in-flight request slot, see SerializeRequests
+	loginMu  sync.Mutex    // serializes automatic re-logins
+	loginGen uint64        // incremented at each successful login
+}
+
+// A CredentialsProvider returns the login and password used to
+// authenticate a session. See WithCredentials option.
+type CredentialsProvider func(ctx context.Context) (login, password string, err error)
+
+// StaticCredentials returns a CredentialsProvider always returning
+// login and password.
+func StaticCredentials(login, password string) CredentialsProvider {
+	return func(context.Context) (string, string, error) {
+		return login, password, nil
+	}
+}
+
+// NewSession returns a new Session configured using options.
+func NewSession(options ...Option) *Session {
+	v := &Session{}
+	for _, option := range options {
+		option(v)
+	}
+	return v
+}
+
+// Endpoint returns the URL of the Vitodata API used by this session.
+func (v *Session) Endpoint() string {
+	if v.endpoint != "" {
+		return v.endpoint
+	}
+	return MainURL
+}
+
+// SOAPNamespace returns the SOAP namespace used by this session.
+func (v *Session) SOAPNamespace() string {
+	if v.namespace != "" {
+		return v.namespace
+	}
+	return soapURL
+}
+
+func (v *Session) httpClient() *http.Client {
+	if v.HTTPClient != nil {
+		return v.HTTPClient
+	}
+	if v.Transport != nil {
+		return &http.Client{
+			Timeout:   DefaultHTTPTimeout,
+			Transport: v.Transport,
+		}
+	}
+	return DefaultHTTPClient
+}
+
+// sendRequest marshals request into a SOAP envelope, sends it and
+// decodes its response in respBody. Idempotent requests are retried
+// following the Retry policy. If the session expired and its
+// credentials are known, it is re-authenticated and the request is
+// sent once again.
+func (v *Session) sendRequest(ctx context.Context, soapAction string, request interface{}, respBody HasResultHeader) error {
+	reqBody, err := marshalRequest(v.SOAPNamespace(), request)
+	if err != nil {
+		return err
+	}
+
+	attrs := requestAttrs(request)
+	return v.withRetry(ctx, soapAction, func() error {
+		return v.sendRequestOnce(ctx, soapAction, reqBody, respBody, attrs)
+	})
+}
+
+func (v *Session) sendRequestOnce(ctx context.Context, soapAction string, reqBody []byte, respBody HasResultHeader, attrs []interface{}) error {
+	v.mu.Lock()
+	gen, hasCredentials := v.loginGen, v.credentials != nil
+	v.mu.Unlock()
+
+	err := v.doRequest(ctx, soapAction, reqBody, respBody, attrs)
+	if err == nil ||
+		soapAction == "Login" ||
+		!hasCredentials ||
+		!v.isSessionExpired(err) {
+		return err
+	}
+
+	err = v.reloginOnce(ctx, gen)
+	if err != nil {
+		return err
+	}
+
+	return v.doRequest(ctx, soapAction, reqBody, respBody, attrs)
+}
+
+func (v *Session) isSessionExpired(err error) bool {
+	if v.SessionExpired != nil {
+		return v.SessionExpired(err)
+	}
+	return errors.Is(err, ErrSessionExpired)
+}
+
+// reloginOnce re-authenticates the session, except if another
+// goroutine did it since the login generation gen.
+func (v *Session) reloginOnce(ctx context.Context, gen uint64) error {
+	v.loginMu.Lock()
+	defer v.loginMu.Unlock()
+
+	v.mu.Lock()
+	alreadyDone := v.loginGen != gen
+	v.mu.Unlock()
+	if alreadyDone {
+		return nil
+	}
+
+	err := v.relogin(ctx)
+	if v.OnRelogin != nil {
+		v.OnRelogin(err)
+	}
+	return err
+}
+
+func (v *Session) relogin(ctx context.Context) error {
+	v.mu.Lock()
+	credentials := v.credentials
+	v.mu.Unlock()
+
+	login, password, err := credentials(ctx)
+	if err != nil {
+		return err
+	}
+	return v.login(ctx, login, password)
+}
+
+// CookiesSnapshot returns a copy of the cookies currently used by the
+// session.
+func (v *Session) CookiesSnapshot() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return append([]string(nil), v.Cookies...)
 }
 
-func (v *Session) sendRequest(soapAction string, reqBody string, respBody HasResultHeader) error {
-	client := &http.Client{}
+// DevicesList returns the list of the devices of the session, as
+// filled by GetDevices. The returned slice is a copy, but the devices
+// it points to are the ones of the session.
+func (v *Session) DevicesList() []*Device {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return append([]*Device(nil), v.Devices...)
+}
 
-	req, err := http.NewRequest("POST", MainURL,
-		bytes.NewBuffer([]byte(reqHeader+reqBody+reqFooter)))
+func (v *Session) doRequest(ctx context.Context, soapAction string, reqBody []byte, respBody HasResultHeader, attrs []interface{}) (err error) {
+	release, err := v.acquire(ctx)
 	if err != nil {
 		return err
 	}
+	defer release()
 
-	req.Header.Set("SOAPAction", soapURL+soapAction)
+	logger := v.logger().With("action", soapAction).With(attrs...)
+	start := time.Now()
+	status := 0
+	var result *ResultHeader
+	defer func() {
+		logRequest(ctx, logger, start, status, result, err)
+	}()
+
+	client := v.httpClient()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", v.Endpoint(),
+		bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("SOAPAction", v.SOAPNamespace()+soapAction)
 	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	for _, cookie := range v.Cookies {
+	cookies := v.CookiesSnapshot()
+	for _, cookie := range cookies {
 		req.Header.Add("Cookie", cookie)
 	}
 
+	if logger.Enabled(ctx, slog.LevelDebug) {
+		logger.LogAttrs(ctx, slog.LevelDebug, "SOAP request body",
+			slog.Any("cookies", redactCookies(cookies)),
+			slog.String("body", redactBody(reqBody)))
+	}
+
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
+	status = resp.StatusCode
 	respBodyRaw, _ := io.ReadAll(resp.Body)
 
+	if logger.Enabled(ctx, slog.LevelDebug) {
+		logger.LogAttrs(ctx, slog.LevelDebug, "SOAP response body",
+			slog.Any("cookies", redactCookies(resp.Header.Values("Set-Cookie"))),
+			slog.String("body", string(respBodyRaw)))
+	}
+
 	if resp.StatusCode == 200 {
 		cookies := resp.Header[http.CanonicalHeaderKey("Set-Cookie")]
 		if cookies != nil {
+			v.mu.Lock()
 			v.Cookies = cookies
+			v.mu.Unlock()
 		}
 
-		if v.Debug {
-			log.Println(string(respBodyRaw))
-		}
+		// respBody can be reused when the request is replayed
+		pResp := reflect.ValueOf(respBody).Elem()
+		pResp.Set(reflect.Zero(pResp.Type()))
 
 		err = xml.Unmarshal(respBodyRaw, respBody)
 		if err != nil {
@@ -73,14 +364,39 @@ func (v *Session) sendRequest(soapAction string, reqBody string, respBody HasRes
 		}
 
 		// Applicative error
-		if respBody.ResultHeader().IsError() {
-			return respBody.ResultHeader()
+		result = respBody.ResultHeader()
+		if result.IsError() {
+			result.err = v.ResultErrors[result.ErrorNum]
+			return result
 		}
 		return nil
 	}
 
-	return fmt.Errorf("HTTP error: [status=%d] %v (%+v)",
-		resp.StatusCode, respBodyRaw, resp.Header)
+	err = parseSOAPFault(&HTTPError{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       respBodyRaw,
+	})
+	return err
+}
+
+// logRequest logs the outcome of a SOAP request started at start. The
+// HTTP status is 0 if no response has been received, result is nil
+// if no response has been decoded.
+func logRequest(ctx context.Context, logger *slog.Logger, start time.Time, status int, result *ResultHeader, err error) {
+	level := slog.LevelDebug
+	attrs := []slog.Attr{
+		slog.Duration("duration", time.Since(start)),
+		slog.Int("status", status),
+	}
+	if result != nil {
+		attrs = append(attrs, slog.Int("result", result.ErrorNum))
+	}
+	if err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	logger.LogAttrs(ctx, level, "SOAP request", attrs...)
 }
 
 //
@@ -103,24 +419,73 @@ func (r *LoginResponse) ResultHeader() *ResultHeader {
 }
 
 // Login authenticates the session on the Vitotrol™ server using the
-// Login request.
+// Login request. On success, login and password are remembered to
+// automatically re-authenticate the session when it expires, as
+// soon as its expiration can be detected: the automatic re-login is
+// disabled unless WithSessionExpiry or WithResultErrors is used.
 func (v *Session) Login(login, password string) error {
-	body := `<Login>
-<AppId>prod</AppId>
-<AppVersion>4.3.1</AppVersion>
-<Passwort>` + password + `</Passwort>
-<Betriebssystem>Android</Betriebssystem>
-<Benutzer>` + login + `</Benutzer>
-</Login>`
+	return v.LoginContext(context.Background(), login, password)
+}
 
+// LoginContext is the same as Login but allows to pass a context
+// controlling the cancellation and the deadline of the request.
+func (v *Session) LoginContext(ctx context.Context, login, password string) error {
+	err := v.login(ctx, login, password)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.credentials = StaticCredentials(login, password)
+	v.mu.Unlock()
+	return nil
+}
+
+// LoginWithCredentials authenticates the session on the Vitotrol™
+// server using the credentials set by WithCredentials option or
+// remembered by a previous Login call.
+func (v *Session) LoginWithCredentials(ctx context.Context) error {
+	v.mu.Lock()
+	hasCredentials := v.credentials != nil
+	v.mu.Unlock()
+
+	if !hasCredentials {
+		return errors.New("No credentials available")
+	}
+	return v.relogin(ctx)
+}
+
+type loginRequest struct {
+	XMLName    xml.Name `xml:"Login"`
+	AppID      string   `xml:"AppId"`
+	AppVersion string   `xml:"AppVersion"`
+	Password   string   `xml:"Passwort"`
+	System     string   `xml:"Betriebssystem"`
+	Login      string   `xml:"Benutzer"`
+}
+
+func (v *Session) login(ctx context.Context, login, password string) error {
+	body := loginRequest{
+		AppID:      "prod",
+		AppVersion: "4.3.1",
+		Password:   password,
+		System:     "Android",
+		Login:      login,
+	}
+
+	v.mu.Lock()
 	v.Cookies = nil
+	v.mu.Unlock()
 
 	var resp LoginResponse
-	err := v.sendRequest("Login", body, &resp)
+	err := v.sendRequest(ctx, "Login", &body, &resp)
 	if err != nil {
 		return err
 	}
 
+	v.mu.Lock()
+	v.loginGen++
+	v.mu.Unlock()
 	return nil
 }
 
@@ -128,6 +493,10 @@ func (v *Session) Login(login, password string) error {
 // GetDevices
 //
 
+type getDevicesRequest struct {
+	XMLName xml.Name `xml:"GetDevices"`
+}
+
 type getDevicesDevices struct {
 	ID          uint32 `xml:"GeraetId"`
 	Name        string `xml:"GeraetName"`
@@ -159,25 +528,60 @@ func (r *GetDevicesResponse) ResultHeader() *ResultHeader {
 // GetDevices launches the Vitotrol™ GetDevices request. Populates the
 // internal cache before returning (see Devices field).
 func (v *Session) GetDevices() error {
+	return v.GetDevicesContext(context.Background())
+}
+
+// GetDevicesContext is the same as GetDevices but allows to pass a
+// context controlling the cancellation and the deadline of the
+// request.
+func (v *Session) GetDevicesContext(ctx context.Context) error {
 	var resp GetDevicesResponse
-	err := v.sendRequest("GetDevices", "<GetDevices/>", &resp)
+	err := v.sendRequest(ctx, "GetDevices", &getDevicesRequest{}, &resp)
 	if err != nil {
 		return err
 	}
 
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	type deviceKey struct{ locationID, deviceID uint32 }
+	known := make(map[deviceKey]*Device, len(v.Devices))
+	for _, d := range v.Devices {
+		known[deviceKey{d.LocationID, d.DeviceID}] = d
+	}
+
 	// 0 or 1 Location
 	for _, location := range resp.GetDevicesResult.Locations {
 		for _, device := range location.Devices {
-			v.Devices = append(v.Devices, Device{
+			key := deviceKey{location.ID, device.ID}
+			info := DeviceInfo{
 				LocationID:   location.ID,
 				LocationName: location.Name,
 				DeviceID:     device.ID,
 				DeviceName:   device.Name,
 				HasError:     location.HasError || device.HasError,
 				IsConnected:  location.IsConnected && device.IsConnected,
+			}
+
+			// Already known device: refresh it in place, so pointers
+			// previously returned by DevicesList stay valid
+			if d := known[key]; d != nil {
+				d.setInfo(info)
+				continue
+			}
+
+			d := &Device{
+				LocationID:   info.LocationID,
+				LocationName: info.LocationName,
+				DeviceID:     info.DeviceID,
+				DeviceName:   info.DeviceName,
+				HasError:     info.HasError,
+				IsConnected:  info.IsConnected,
 				Attributes:   map[AttrID]*Value{},
 				Timesheets:   map[TimesheetID]map[string]TimeslotSlice{},
-			})
+			}
+			known[key] = d
+			v.Devices = append(v.Devices, d)
 		}
 	}
 
@@ -196,12 +600,17 @@ func (v *Session) GetDevices() error {
 // RequestRefreshStatus
 //
 
+type requestRefreshStatusRequest struct {
+	XMLName   xml.Name `xml:"RequestRefreshStatus"`
+	RefreshID string   `xml:"AktualisierungsId"`
+}
+
 // RequestRefreshStatusResponse is a response to a
 // RequestRefreshStatus request.
 type RequestRefreshStatusResponse struct {
 	RequestRefreshStatusResult struct {
 		ResultHeader
-		Status int `xml:"Status"`
+		Status RefreshStatus `xml:"Status"`
 	} `xml:"Body>RequestRefreshStatusResponse>RequestRefreshStatusResult"`
 }
 
@@ -213,13 +622,17 @@ func (r *RequestRefreshStatusResponse) ResultHeader() *ResultHeader {
 // RequestRefreshStatus launches the Vitotrol™ RequestRefreshStatus
 // request to follow the status of the RefreshData request matching
 // the passed refresh ID. Use RefreshDataWait instead.
-func (v *Session) RequestRefreshStatus(refreshID string) (int, error) {
+func (v *Session) RequestRefreshStatus(refreshID string) (RefreshStatus, error) {
+	return v.RequestRefreshStatusContext(context.Background(), refreshID)
+}
+
+// RequestRefreshStatusContext is the same as RequestRefreshStatus
+// but allows to pass a context controlling the cancellation and the
+// deadline of the request.
+func (v *Session) RequestRefreshStatusContext(ctx context.Context, refreshID string) (RefreshStatus, error) {
 	var resp RequestRefreshStatusResponse
-	err := v.sendRequest("RequestRefreshStatus",
-		"<RequestRefreshStatus><AktualisierungsId>"+
-			refreshID+
-			"</AktualisierungsId></RequestRefreshStatus>",
-		&resp)
+	err := v.sendRequest(ctx, "RequestRefreshStatus",
+		&requestRefreshStatusRequest{RefreshID: refreshID}, &resp)
 	if err != nil {
 		return 0, err
 	}
@@ -231,11 +644,16 @@ func (v *Session) RequestRefreshStatus(refreshID string) (int, error) {
 // RequestWriteStatus
 //
 
+type requestWriteStatusRequest struct {
+	XMLName   xml.Name `xml:"RequestWriteStatus"`
+	RefreshID string   `xml:"AktualisierungsId"`
+}
+
 // RequestWriteStatusResponse is a response to a RequestWriteStatus request.
 type RequestWriteStatusResponse struct {
 	RequestWriteStatusResult struct {
 		ResultHeader
-		Status int `xml:"Status"`
+		Status WriteStatus `xml:"Status"`
 	} `xml:"Body>RequestWriteStatusResponse>RequestWriteStatusResult"`
 }
 
@@ -247,13 +665,17 @@ func (r *RequestWriteStatusResponse) ResultHeader() *ResultHeader {
 // RequestWriteStatus launches the Vitotrol™ RequestWriteStatus
 // request to follow the status of the WriteData request matching
 // the passed refresh ID. Use WriteDataWait instead.
-func (v *Session) RequestWriteStatus(refreshID string) (int, error) {
+func (v *Session) RequestWriteStatus(refreshID string) (WriteStatus, error) {
+	return v.RequestWriteStatusContext(context.Background(), refreshID)
+}
+
+// RequestWriteStatusContext is the same as RequestWriteStatus but
+// allows to pass a context controlling the cancellation and the
+// deadline of the request.
+func (v *Session) RequestWriteStatusContext(ctx context.Context, refreshID string) (WriteStatus, error) {
 	var resp RequestWriteStatusResponse
-	err := v.sendRequest("RequestWriteStatus",
-		"<RequestWriteStatus><AktualisierungsId>"+
-			refreshID+
-			"</AktualisierungsId></RequestWriteStatus>",
-		&resp)
+	err := v.sendRequest(ctx, "RequestWriteStatus",
+		&requestWriteStatusRequest{RefreshID: refreshID}, &resp)
 	if err != nil {
 		return 0, err
 	}
@@ -1,12 +1,16 @@
 package vitotrol
 
 import (
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	td "github.com/maxatome/go-testdeep"
@@ -96,6 +100,16 @@ func (r *TestResponse) ResultHeader() *ResultHeader {
 	return &r.TestResult.ResultHeader
 }
 
+type xxxRequest struct {
+	XMLName xml.Name `xml:"xxx"`
+}
+
+type testSOAPRequest struct {
+	XMLName xml.Name `xml:"Test"`
+	Foo     string   `xml:"Foo"`
+	Bar     string   `xml:"Bar"`
+}
+
 func TestSendRequestErrors(tt *testing.T) {
 	t := td.NewT(tt)
 
@@ -104,12 +118,12 @@ func TestSendRequestErrors(tt *testing.T) {
 	// bad URL -> parse URL will fail
 	MainURL = ":"
 	var resp TestResponse
-	err := v.sendRequest("bad", `<xxx></xxx>`, &resp)
+	err := v.sendRequest(context.Background(), "bad", &xxxRequest{}, &resp)
 	t.CmpError(err)
 
 	// bad scheme -> Do request will fail
 	MainURL = "bad-scheme:..."
-	err = v.sendRequest("bad", `<xxx></xxx>`, &resp)
+	err = v.sendRequest(context.Background(), "bad", &xxxRequest{}, &resp)
 	t.CmpError(err)
 
 	// HTTP status error
@@ -120,8 +134,30 @@ func TestSendRequestErrors(tt *testing.T) {
 	defer ts.Close()
 
 	MainURL = ts.URL
-	err = v.sendRequest("bad", `<xxx></xxx>`, &resp)
+	err = v.sendRequest(context.Background(), "bad", &xxxRequest{}, &resp)
 	t.CmpError(err)
+	t.Isa(err, &HTTPError{})
+	t.CmpDeeply(err, td.Struct(&HTTPError{StatusCode: 500}, nil))
+
+	// SOAP fault
+	ts = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintln(w, respHeader+`<soap:Fault>
+  <faultcode>soap:Client</faultcode>
+  <faultstring>Unknown SOAPAction</faultstring>
+</soap:Fault>`+respFooter)
+		}))
+	defer ts.Close()
+
+	MainURL = ts.URL
+	err = v.sendRequest(context.Background(), "bad", &xxxRequest{}, &resp)
+	if t.Isa(err, &SOAPFault{}) {
+		t.CmpDeeply(err, td.Struct(&SOAPFault{
+			Code:   "soap:Client",
+			String: "Unknown SOAPAction",
+		}, nil))
+	}
 }
 
 func TestSendRequest(tt *testing.T) {
@@ -139,11 +175,8 @@ func TestSendRequest(tt *testing.T) {
 			v.Cookies = []string{"foo=123", "bar=456"}
 
 			var resp TestResponse
-			err := v.sendRequest("foobar", `
-<Test>
-  <Foo>foo</Foo>
-  <Bar>bar</Bar>
-</Test>`, &resp)
+			err := v.sendRequest(context.Background(), "foobar",
+				&testSOAPRequest{Foo: "foo", Bar: "bar"}, &resp)
 			if !t.CmpNoError(err) {
 				return false
 			}
@@ -182,11 +215,8 @@ func TestSendRequest(tt *testing.T) {
 			v.Debug = true
 
 			var resp TestResponse
-			err := v.sendRequest("foobar", `
-<Test>
-  <Foo>foo</Foo>
-  <Bar>bar</Bar>
-</Test>`, &resp)
+			err := v.sendRequest(context.Background(), "foobar",
+				&testSOAPRequest{Foo: "foo", Bar: "bar"}, &resp)
 			return t.CmpError(err)
 		},
 		// SOAP action
@@ -205,19 +235,25 @@ func TestSendRequest(tt *testing.T) {
 		// Send request and check result
 		func(v *Session) bool {
 			var resp TestResponse
-			err := v.sendRequest("foobar", `
-<Test>
-  <Foo>foo</Foo>
-  <Bar>bar</Bar>
-</Test>`, &resp)
+			err := v.sendRequest(context.Background(), "foobar",
+				&testSOAPRequest{Foo: "foo", Bar: "bar"}, &resp)
 			if !t.CmpError(err) || !t.Isa(err, &ResultHeader{}) {
 				return false
 			}
-			return t.CmpDeeply(err.(*ResultHeader),
+			if !t.CmpDeeply(err.(*ResultHeader),
 				td.Struct(&ResultHeader{
 					ErrorNum: 42,
 					ErrorStr: "ERROR!!!",
-				}, nil))
+				}, nil)) {
+				return false
+			}
+			t.False(errors.Is(err, ErrDeviceOffline), "not mapped")
+
+			// Mapped by the session
+			v.ResultErrors = map[int]error{42: ErrDeviceOffline}
+			err = v.sendRequest(context.Background(), "foobar",
+				&testSOAPRequest{Foo: "foo", Bar: "bar"}, &resp)
+			return t.CmpErrorIs(err, ErrDeviceOffline)
 		},
 		// SOAP action
 		"foobar",
@@ -241,7 +277,7 @@ func TestSendRequest(tt *testing.T) {
 func TestLogin(tt *testing.T) {
 	t := td.NewT(tt)
 
-	type loginRequest struct {
+	type requestLogin struct {
 		AppID      string `xml:"Body>Login>AppId"`
 		AppVersion string `xml:"Body>Login>AppVersion"`
 		Password   string `xml:"Body>Login>Passwort"`
@@ -249,7 +285,7 @@ func TestLogin(tt *testing.T) {
 		Login      string `xml:"Body>Login>Benutzer"`
 	}
 
-	expectedRequest := &loginRequest{
+	expectedRequest := &requestLogin{
 		AppID:      "prod",
 		AppVersion: "4.3.1",
 		Password:   "bingo",
@@ -297,11 +333,11 @@ func TestLogin(tt *testing.T) {
 func TestGetDevices(tt *testing.T) {
 	t := td.NewT(tt)
 
-	type getDevicesRequest struct {
+	type requestGetDevices struct {
 		Dummy string `xml:"Body>GetDevices,omitempty"`
 	}
 
-	expectedRequest := &getDevicesRequest{}
+	expectedRequest := &requestGetDevices{}
 
 	// No problem
 	testSendRequestAny(t,
@@ -312,7 +348,7 @@ func TestGetDevices(tt *testing.T) {
 				return false
 			}
 			return t.CmpDeeply(v.Devices,
-				[]Device{
+				[]*Device{
 					{
 						LocationID:   31456,
 						LocationName: "Paris",
@@ -381,16 +417,95 @@ func TestGetDevices(tt *testing.T) {
 		"GetDevices with error")
 }
 
+func TestGetDevicesTwice(tt *testing.T) {
+	t := td.NewT(tt)
+
+	var mu sync.Mutex
+	connected := true
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			soapActionURL := r.Header.Get("SOAPAction")
+			action := soapActionURL[strings.LastIndex(soapActionURL, "/")+1:]
+
+			result := `<Ergebnis>0</Ergebnis><ErgebnisText>Kein Fehler</ErgebnisText>`
+			switch action {
+			case "GetDevices":
+				mu.Lock()
+				result += fmt.Sprintf(`<AnlageListe><AnlageV2>
+<AnlageId>12</AnlageId><AnlageName>Home</AnlageName>
+<GeraeteListe><GeraetV2>
+<GeraetId>34</GeraetId><GeraetName>Boiler</GeraetName>
+<IstVerbunden>%t</IstVerbunden>
+</GeraetV2></GeraeteListe>
+<IstVerbunden>true</IstVerbunden>
+</AnlageV2></AnlageListe>`, connected)
+				mu.Unlock()
+			case "GetData":
+				result += `<DatenwerteListe><WerteListe>
+<DatenpunktId>11</DatenpunktId><Wert>value11</Wert>
+<Zeitstempel>` + testTimeStr + `</Zeitstempel>
+</WerteListe></DatenwerteListe>`
+			}
+			fmt.Fprintln(w, respHeader+intoDeviceResponse(action, result)+respFooter)
+		}))
+	defer ts.Close()
+
+	v := NewSession(WithEndpoint(ts.URL))
+	t.Require().CmpNoError(v.GetDevices())
+	old := v.DevicesList()
+	t.Require().Len(old, 1)
+	t.True(old[0].IsConnected)
+
+	mu.Lock()
+	connected = false
+	mu.Unlock()
+
+	// Known devices are reused and refreshed in place
+	t.Require().CmpNoError(v.GetDevices())
+	devices := v.DevicesList()
+	t.Require().Len(devices, 1)
+	t.Shallow(devices[0], old[0])
+	t.CmpDeeply(devices[0].Info(), DeviceInfo{
+		LocationID:   12,
+		LocationName: "Home",
+		DeviceID:     34,
+		DeviceName:   "Boiler",
+		IsConnected:  false,
+	})
+
+	var wg sync.WaitGroup
+	for _, d := range []*Device{old[0], devices[0]} {
+		wg.Add(3)
+		go func(d *Device) {
+			defer wg.Done()
+			t.CmpNoError(d.GetData(v, []AttrID{11}))
+		}(d)
+		go func() {
+			defer wg.Done()
+			t.CmpNoError(v.GetDevices())
+		}()
+		go func(d *Device) {
+			defer wg.Done()
+			d.Info()
+		}(d)
+	}
+	wg.Wait()
+
+	value, ok := devices[0].Attribute(11)
+	t.True(ok)
+	t.CmpDeeply(value.Value, "value11")
+}
+
 //
 // RequestRefreshStatus
 //
 
-type requestRefreshStatusRequest struct {
+type requestRefreshStatus struct {
 	AktualisierungsID string `xml:"Body>RequestRefreshStatus>AktualisierungsId"`
 }
 
 var requestRefreshStatusTest = testAction{
-	expectedRequest: &requestRefreshStatusRequest{
+	expectedRequest: &requestRefreshStatus{
 		AktualisierungsID: "123456789",
 	},
 	serverResponse: `<RequestRefreshStatusResponse xmlns="http://www.e-controlnet.de/services/vii/">
@@ -410,7 +525,7 @@ func TestRequestRefreshStatus(tt *testing.T) {
 		// Send request and check result
 		func(v *Session) bool {
 			status, err := v.RequestRefreshStatus("123456789")
-			return t.CmpNoError(err) && t.CmpDeeply(status, 4)
+			return t.CmpNoError(err) && t.CmpDeeply(status, RefreshDone)
 		},
 		// SOAP action
 		"RequestRefreshStatus",
@@ -438,12 +553,12 @@ func TestRequestRefreshStatus(tt *testing.T) {
 // RequestWriteStatus
 //
 
-type requestWriteStatusRequest struct {
+type requestWriteStatus struct {
 	AktualisierungsID string `xml:"Body>RequestWriteStatus>AktualisierungsId"`
 }
 
 var requestWriteStatusTest = testAction{
-	expectedRequest: &requestWriteStatusRequest{
+	expectedRequest: &requestWriteStatus{
 		AktualisierungsID: "123456789",
 	},
 	serverResponse: `<RequestWriteStatusResponse xmlns="http://www.e-controlnet.de/services/vii/">
@@ -463,7 +578,7 @@ func TestRequestWriteStatus(tt *testing.T) {
 		// Send request and check result
 		func(v *Session) bool {
 			status, err := v.RequestWriteStatus("123456789")
-			return t.CmpNoError(err) && t.CmpDeeply(status, 4)
+			return t.CmpNoError(err) && t.CmpDeeply(status, WriteDone)
 		},
 		// SOAP action
 		"RequestWriteStatus",
@@ -486,3 +601,214 @@ func TestRequestWriteStatus(tt *testing.T) {
 		`<bad XML>`,
 		"RequestWriteStatus with error")
 }
+
+func TestSendRequestContext(tt *testing.T) {
+	t := td.NewT(tt)
+
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			t.Error("request should not be sent with a canceled context")
+		}))
+	defer ts.Close()
+
+	MainURL = ts.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	v := &Session{}
+	err := v.LoginContext(ctx, "pipo", "bingo")
+	t.CmpErrorIs(err, context.Canceled)
+
+	err = v.GetDevicesContext(ctx)
+	t.CmpErrorIs(err, context.Canceled)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestSendRequestHTTPClient(tt *testing.T) {
+	t := td.NewT(tt)
+
+	v := &Session{}
+	t.Shallow(v.httpClient(), DefaultHTTPClient)
+
+	client := &http.Client{}
+	v.HTTPClient = client
+	t.Shallow(v.httpClient(), client)
+
+	// Transport is only used when HTTPClient is nil
+	var called int
+	v = &Session{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			called++
+			t.CmpDeeply(r.Header.Get("SOAPAction"), soapURL+"Login")
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body: io.NopCloser(strings.NewReader(respHeader +
+					intoDeviceResponse("Login", `<Ergebnis>0</Ergebnis>
+<ErgebnisText>Kein Fehler</ErgebnisText>`) +
+					respFooter)),
+			}, nil
+		}),
+	}
+	t.CmpDeeply(v.httpClient().Timeout, DefaultHTTPTimeout)
+
+	MainURL = "http://vitotrol.test/"
+	t.CmpNoError(v.Login("pipo", "bingo"))
+	t.CmpDeeply(called, 1)
+}
+
+func TestRelogin(tt *testing.T) {
+	t := td.NewT(tt)
+
+	expired := `<Ergebnis>7</Ergebnis><ErgebnisText>Nicht angemeldet</ErgebnisText>`
+
+	var actions []string
+	loggedIn := false
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			soapActionURL := r.Header.Get("SOAPAction")
+			action := soapActionURL[strings.LastIndex(soapActionURL, "/")+1:]
+			actions = append(actions, action)
+
+			result := `<Ergebnis>0</Ergebnis><ErgebnisText>Kein Fehler</ErgebnisText>`
+			switch action {
+			case "Login":
+				loggedIn = true
+			case "GetDevices":
+				if !loggedIn {
+					result = expired
+				}
+			}
+			fmt.Fprintln(w, respHeader+intoDeviceResponse(action, result)+respFooter)
+		}))
+	defer ts.Close()
+
+	expiry := WithSessionExpiry(MatchResult(7))
+
+	// No credentials known
+	v := NewSession(WithEndpoint(ts.URL), expiry)
+	err := v.GetDevices()
+	t.CmpDeeply(err, &ResultHeader{ErrorNum: 7, ErrorStr: "Nicht angemeldet"})
+	t.CmpDeeply(actions, []string{"GetDevices"})
+	t.CmpError(v.LoginWithCredentials(context.Background()))
+
+	// Credentials remembered by Login
+	actions, loggedIn = nil, false
+	var relogins []error
+	v = NewSession(
+		WithEndpoint(ts.URL),
+		expiry,
+		WithReloginHook(func(err error) { relogins = append(relogins, err) }))
+	t.CmpNoError(v.Login("pipo", "bingo"))
+	loggedIn = false // session expired
+	t.CmpNoError(v.GetDevices())
+	t.CmpDeeply(actions, []string{"Login", "GetDevices", "Login", "GetDevices"})
+	t.CmpDeeply(relogins, []error{nil})
+
+	// Expiration not recognized, as nothing is mapped in ResultErrors
+	actions, loggedIn, relogins = nil, false, nil
+	v = NewSession(
+		WithEndpoint(ts.URL),
+		WithReloginHook(func(err error) { relogins = append(relogins, err) }))
+	t.CmpNoError(v.Login("pipo", "bingo"))
+	loggedIn = false // session expired
+	t.CmpError(v.GetDevices())
+	t.CmpDeeply(actions, []string{"Login", "GetDevices"})
+	t.Nil(relogins)
+
+	// Expiration recognized using ResultErrors
+	v.ResultErrors = map[int]error{7: ErrSessionExpired}
+	actions = nil
+	t.CmpNoError(v.GetDevices())
+	t.CmpDeeply(actions, []string{"GetDevices", "Login", "GetDevices"})
+	t.CmpDeeply(relogins, []error{nil})
+
+	// Credentials provider
+	actions, loggedIn, relogins = nil, false, nil
+	var provided int
+	v = NewSession(
+		WithEndpoint(ts.URL),
+		expiry,
+		WithCredentials(func(context.Context) (string, string, error) {
+			provided++
+			return "pipo", "bingo", nil
+		}),
+		WithReloginHook(func(err error) { relogins = append(relogins, err) }))
+	t.CmpNoError(v.GetDevices())
+	t.CmpDeeply(actions, []string{"GetDevices", "Login", "GetDevices"})
+	t.CmpDeeply(provided, 1)
+	t.CmpDeeply(relogins, []error{nil})
+
+	actions, loggedIn = nil, false
+	t.CmpNoError(v.LoginWithCredentials(context.Background()))
+	t.CmpDeeply(actions, []string{"Login"})
+	t.CmpDeeply(provided, 2)
+
+	// Credentials provider fails
+	actions, loggedIn, relogins = nil, false, nil
+	providerErr := fmt.Errorf("no password")
+	v = NewSession(
+		WithEndpoint(ts.URL),
+		expiry,
+		WithCredentials(func(context.Context) (string, string, error) {
+			return "", "", providerErr
+		}),
+		WithReloginHook(func(err error) { relogins = append(relogins, err) }))
+	t.CmpErrorIs(v.GetDevices(), providerErr)
+	t.CmpDeeply(actions, []string{"GetDevices"})
+	t.CmpDeeply(relogins, []error{providerErr})
+}
+
+func TestConcurrentRelogin(tt *testing.T) {
+	t := td.NewT(tt)
+
+	var mu sync.Mutex
+	logins := 0
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			soapActionURL := r.Header.Get("SOAPAction")
+			action := soapActionURL[strings.LastIndex(soapActionURL, "/")+1:]
+
+			result := `<Ergebnis>0</Ergebnis><ErgebnisText>Kein Fehler</ErgebnisText>`
+			switch action {
+			case "Login":
+				mu.Lock()
+				logins++
+				cookie := fmt.Sprintf("session=%d", logins)
+				mu.Unlock()
+				w.Header().Set("Set-Cookie", cookie)
+			default:
+				if r.Header.Get("Cookie") != "session=2" {
+					result = `<Ergebnis>7</Ergebnis><ErgebnisText>Nicht angemeldet</ErgebnisText>`
+				}
+			}
+			fmt.Fprintln(w, respHeader+intoDeviceResponse(action, result)+respFooter)
+		}))
+	defer ts.Close()
+
+	v := NewSession(WithEndpoint(ts.URL), WithSessionExpiry(MatchResult(7)))
+	t.CmpNoError(v.Login("pipo", "bingo"))
+	t.CmpDeeply(v.CookiesSnapshot(), []string{"session=1"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.CmpNoError(v.GetDevices())
+		}()
+	}
+	wg.Wait()
+
+	// Only one re-login for all goroutines
+	mu.Lock()
+	t.CmpDeeply(logins, 2)
+	mu.Unlock()
+	t.CmpDeeply(v.CookiesSnapshot(), []string{"session=2"})
+}
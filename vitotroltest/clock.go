@@ -0,0 +1,130 @@
+package vitotroltest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/maxatome/go-vitotrol"
+)
+
+// Clock is a fake vitotrol.Clock whose time only changes when
+// advanced manually. It is safe for concurrent use.
+//
+//	clock := vitotroltest.NewClock(time.Now())
+//	fake.Now = clock.Now
+//	v := vitotrol.NewSession(vitotrol.WithClock(clock), …)
+//
+//	op, err := d.StartWriteData(ctx, v, vitotrol.IndoorTemp, "20")
+//	clock.BlockUntil(1) // wait for the first status poll to be scheduled
+//	clock.Advance(vitotrol.WriteDataWaitDuration)
+type Clock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*clockTimer
+}
+
+var _ vitotrol.Clock = (*Clock)(nil)
+
+// NewClock returns a new Clock set to now.
+func NewClock(now time.Time) *Clock {
+	c := &Clock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the current time of c.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTimer returns a new timer firing when c is advanced by at least
+// d. If d <= 0, the timer fires immediately.
+func (c *Clock) NewTimer(d time.Duration) vitotrol.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &clockTimer{
+		clock:    c,
+		ch:       make(chan time.Time, 1),
+		deadline: c.now.Add(d),
+	}
+	if d <= 0 {
+		t.ch <- c.now
+		return t
+	}
+
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// Advance moves the time of c forward by d, firing the timers
+// reaching their deadline.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].deadline.Before(c.timers[j].deadline)
+	})
+
+	remaining := c.timers[:0]
+	for _, t := range c.timers {
+		if t.deadline.After(c.now) {
+			remaining = append(remaining, t)
+			continue
+		}
+		t.ch <- c.now
+	}
+	c.timers = remaining
+}
+
+// Timers returns the number of timers waiting to fire.
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+// BlockUntil blocks until at least n timers are waiting to fire. It
+// allows to synchronize with goroutines before calling Advance.
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+type clockTimer struct {
+	clock    *Clock
+	ch       chan time.Time
+	deadline time.Time
+}
+
+func (t *clockTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *clockTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
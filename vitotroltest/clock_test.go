@@ -0,0 +1,138 @@
+package vitotroltest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	td "github.com/maxatome/go-testdeep"
+
+	"github.com/maxatome/go-vitotrol"
+	"github.com/maxatome/go-vitotrol/vitotroltest"
+)
+
+func fired(timer vitotrol.Timer) bool {
+	select {
+	case <-timer.C():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestClock(tt *testing.T) {
+	t := td.NewT(tt)
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := vitotroltest.NewClock(start)
+	t.Cmp(clock.Now(), start)
+
+	// Immediate
+	t.True(fired(clock.NewTimer(0)))
+	t.Cmp(clock.Timers(), 0)
+
+	t1 := clock.NewTimer(time.Second)
+	t2 := clock.NewTimer(time.Minute)
+	t3 := clock.NewTimer(time.Hour)
+	t.Cmp(clock.Timers(), 3)
+
+	clock.Advance(time.Second)
+	t.Cmp(clock.Now(), start.Add(time.Second))
+	t.True(fired(t1))
+	t.False(fired(t2))
+	t.False(t1.Stop(), "already fired")
+
+	t.True(t3.Stop())
+	t.False(t3.Stop(), "already stopped")
+	t.Cmp(clock.Timers(), 1)
+
+	clock.Advance(2 * time.Hour)
+	t.True(fired(t2))
+	t.False(fired(t3))
+	t.Cmp(clock.Timers(), 0)
+
+	// BlockUntil
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		clock.NewTimer(time.Second)
+	}()
+	clock.BlockUntil(1)
+	t.Cmp(clock.Timers(), 1)
+}
+
+func TestClockOperation(tt *testing.T) {
+	t := td.NewT(tt)
+
+	clock := vitotroltest.NewClock(time.Now())
+
+	fake := vitotroltest.New()
+	fake.Now = clock.Now
+	dev := fake.AddAccount("pipo", "bingo").
+		AddLocation(12, "Home").
+		AddDevice(34, "Boiler")
+	v, d := vitotroltest.NewSessionWithDevice(t, fake, "pipo", "bingo", dev, vitotrol.WithClock(clock))
+	dev.SetWriteStatuses(vitotroltest.StatusPending, vitotroltest.StatusDone)
+
+	// Default waits, without sleeping for real
+	op, err := d.StartWriteData(context.Background(), v, vitotrol.IndoorTemp, "20")
+	if !t.CmpNoError(err) {
+		return
+	}
+	clock.BlockUntil(1)
+	clock.Advance(vitotrol.WriteDataWaitDuration)
+	clock.BlockUntil(1)
+	t.Cmp(op.Status(), vitotrol.WritePending)
+	clock.Advance(vitotrol.WriteDataWaitMinDuration)
+	t.CmpNoError(op.Wait(context.Background()))
+	t.Cmp(op.Status(), vitotrol.WriteDone)
+
+	// Timeout
+	dev.SetWriteStatuses(vitotroltest.StatusPending)
+	op, err = d.StartWriteData(context.Background(), v, vitotrol.IndoorTemp, "21",
+		vitotrol.WithWait(vitotrol.WaitConfig{
+			First:   time.Second,
+			Min:     time.Second,
+			Timeout: 2 * time.Second,
+		}))
+	if !t.CmpNoError(err) {
+		return
+	}
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	t.CmpErrorIs(op.Wait(context.Background()), vitotrol.ErrTimeout)
+}
+
+func TestClockRateLimit(tt *testing.T) {
+	t := td.NewT(tt)
+
+	clock := vitotroltest.NewClock(time.Now())
+
+	fake := vitotroltest.New()
+	fake.AddAccount("pipo", "bingo")
+
+	srv := vitotroltest.NewServer(fake)
+	defer srv.Close()
+
+	// 1 request per second, burst of 1
+	v := vitotrol.NewSession(vitotrol.WithEndpoint(srv.URL),
+		vitotrol.WithClock(clock),
+		vitotrol.WithRateLimit(1, 1))
+
+	// Burst
+	t.CmpNoError(v.Login("pipo", "bingo"))
+
+	done := make(chan error, 1)
+	go func() { done <- v.Login("pipo", "bingo") }()
+
+	clock.BlockUntil(1)
+	select {
+	case <-done:
+		t.Error("request sent before the clock is advanced")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	t.CmpNoError(<-done)
+}
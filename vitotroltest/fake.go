@@ -0,0 +1,364 @@
+// Package vitotroltest provides a stateful in-memory fake of the
+// Vitotrol™ iPhoneWebService, allowing to test code using the
+// vitotrol package without reaching the Viessmann servers.
+//
+//	fake := vitotroltest.New()
+//	dev := fake.AddAccount("login", "password").
+//		AddLocation(1, "Home").
+//		AddDevice(2, "Boiler")
+//	dev.SetValue(vitotrol.IndoorTemp, "21.5")
+//
+//	srv := vitotroltest.NewServer(fake)
+//	defer srv.Close()
+//
+//	v := vitotrol.NewSession(vitotrol.WithEndpoint(srv.URL))
+package vitotroltest
+
+import (
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maxatome/go-vitotrol"
+)
+
+// Statuses returned by RequestRefreshStatus and RequestWriteStatus,
+// see vitotrol.RefreshStatus and vitotrol.WriteStatus.
+const (
+	StatusPending      = int(vitotrol.WritePending)
+	StatusInProgress   = int(vitotrol.WriteInProgress)
+	StatusDone         = int(vitotrol.WriteDone)
+	StatusDoneDateTime = int(vitotrol.WriteDoneDateTime)
+)
+
+// Fake is a stateful in-memory fake of the Vitotrol™
+// iPhoneWebService. It implements http.Handler. It is safe for
+// concurrent use.
+type Fake struct {
+	// Now, if not nil, returns the current time used to timestamp
+	// datapoints. time.Now is used by default.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	accounts map[string]*Account
+	sessions map[string]*Account
+	ops      map[string]*operation
+	faults   []*Fault
+	lastID   uint64
+}
+
+// New returns a new empty Fake.
+func New() *Fake {
+	return &Fake{
+		accounts: map[string]*Account{},
+		sessions: map[string]*Account{},
+		ops:      map[string]*operation{},
+	}
+}
+
+// NewServer starts and returns a new httptest.Server serving f. The
+// caller should call Close when finished, to shut it down.
+func NewServer(f *Fake) *httptest.Server {
+	return httptest.NewServer(f)
+}
+
+func (f *Fake) now() time.Time {
+	if f.Now != nil {
+		return f.Now()
+	}
+	return time.Now()
+}
+
+// Account is an account of a Fake, as returned by Fake.AddAccount.
+type Account struct {
+	fake      *Fake
+	login     string
+	password  string
+	firstname string
+	lastname  string
+	locations []*Location
+}
+
+// AddAccount adds an account to f, replacing any account with the
+// same login.
+func (f *Fake) AddAccount(login, password string) *Account {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	a := &Account{
+		fake:     f,
+		login:    login,
+		password: password,
+	}
+	f.accounts[login] = a
+	return a
+}
+
+// SetName sets the first name and the last name returned by Login.
+func (a *Account) SetName(firstname, lastname string) *Account {
+	a.fake.mu.Lock()
+	defer a.fake.mu.Unlock()
+
+	a.firstname, a.lastname = firstname, lastname
+	return a
+}
+
+// ExpireSessions invalidates all the sessions opened on f, so the
+// next requests fail with ResultSessionExpired until a new
+// Login. Sessions re-login automatically if they use
+// vitotrol.WithSessionExpiry(vitotrol.MatchResult(ResultSessionExpired))
+// or WithResultErrors.
+func (f *Fake) ExpireSessions() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sessions = map[string]*Account{}
+}
+
+// Location is a location of an Account, as returned by
+// Account.AddLocation.
+type Location struct {
+	fake    *Fake
+	id      uint32
+	name    string
+	devices []*Device
+}
+
+// AddLocation adds a location to a.
+func (a *Account) AddLocation(id uint32, name string) *Location {
+	a.fake.mu.Lock()
+	defer a.fake.mu.Unlock()
+
+	l := &Location{
+		fake: a.fake,
+		id:   id,
+		name: name,
+	}
+	a.locations = append(a.locations, l)
+	return l
+}
+
+type datapoint struct {
+	value string
+	time  time.Time
+}
+
+// Device is a device of a Location, as returned by
+// Location.AddDevice.
+type Device struct {
+	fake            *Fake
+	location        *Location
+	id              uint32
+	name            string
+	offline         bool
+	values          map[vitotrol.AttrID]datapoint
+	timesheets      map[vitotrol.TimesheetID]map[string]vitotrol.TimeslotSlice
+	errors          []vitotrol.ErrorHistoryEvent
+	typeInfo        []*vitotrol.AttributeInfo
+	refreshStatuses []int
+	writeStatuses   []int
+	opDuration      time.Duration
+	ignoreWrites    bool
+}
+
+// AddDevice adds a device to l.
+func (l *Location) AddDevice(id uint32, name string) *Device {
+	l.fake.mu.Lock()
+	defer l.fake.mu.Unlock()
+
+	d := &Device{
+		fake:            l.fake,
+		location:        l,
+		id:              id,
+		name:            name,
+		values:          map[vitotrol.AttrID]datapoint{},
+		timesheets:      map[vitotrol.TimesheetID]map[string]vitotrol.TimeslotSlice{},
+		refreshStatuses: []int{StatusDone},
+		writeStatuses:   []int{StatusDone},
+	}
+	l.devices = append(l.devices, d)
+	return d
+}
+
+// SetOffline sets whether d is disconnected from the Vitotrol™
+// server. Requests targeting an offline device fail with
+// ResultDeviceOffline.
+func (d *Device) SetOffline(offline bool) *Device {
+	d.fake.mu.Lock()
+	defer d.fake.mu.Unlock()
+
+	d.offline = offline
+	return d
+}
+
+// SetValue sets the raw value of datapoint id, timestamped with the
+// current time.
+func (d *Device) SetValue(id vitotrol.AttrID, value string) *Device {
+	d.fake.mu.Lock()
+	defer d.fake.mu.Unlock()
+
+	d.values[id] = datapoint{value: value, time: d.fake.now()}
+	return d
+}
+
+// Value returns the raw value of datapoint id and true, or "" and
+// false if the datapoint is unknown.
+func (d *Device) Value(id vitotrol.AttrID) (string, bool) {
+	d.fake.mu.Lock()
+	defer d.fake.mu.Unlock()
+
+	dp, ok := d.values[id]
+	return dp.value, ok
+}
+
+// SetTimesheet sets the timesheet id. Keys of data are days: "mon",
+// "tue", …, "sun".
+func (d *Device) SetTimesheet(id vitotrol.TimesheetID, data map[string]vitotrol.TimeslotSlice) *Device {
+	d.fake.mu.Lock()
+	defer d.fake.mu.Unlock()
+
+	d.timesheets[id] = copyTimesheet(data)
+	return d
+}
+
+// Timesheet returns a copy of the timesheet id and true, or nil and
+// false if the timesheet is unknown. Keys of the returned map are
+// lowercase days.
+func (d *Device) Timesheet(id vitotrol.TimesheetID) (map[string]vitotrol.TimeslotSlice, bool) {
+	d.fake.mu.Lock()
+	defer d.fake.mu.Unlock()
+
+	timesheet, ok := d.timesheets[id]
+	if !ok {
+		return nil, false
+	}
+	return copyTimesheet(timesheet), true
+}
+
+func copyTimesheet(data map[string]vitotrol.TimeslotSlice) map[string]vitotrol.TimeslotSlice {
+	timesheet := make(map[string]vitotrol.TimeslotSlice, len(data))
+	for day, slots := range data {
+		slots = append(vitotrol.TimeslotSlice(nil), slots...)
+		sort.Sort(slots)
+		timesheet[strings.ToLower(day)] = slots
+	}
+	return timesheet
+}
+
+// AddError appends event to the error history of d. A device with an
+// active error is reported with HasError by GetDevices.
+func (d *Device) AddError(event vitotrol.ErrorHistoryEvent) *Device {
+	d.fake.mu.Lock()
+	defer d.fake.mu.Unlock()
+
+	d.errors = append(d.errors, event)
+	return d
+}
+
+// SetTypeInfo sets the catalog of datapoints returned by GetTypeInfo.
+func (d *Device) SetTypeInfo(infos []*vitotrol.AttributeInfo) *Device {
+	d.fake.mu.Lock()
+	defer d.fake.mu.Unlock()
+
+	d.typeInfo = infos
+	return d
+}
+
+// SetRefreshStatuses sets the sequence of statuses returned by the
+// successive RequestRefreshStatus calls following a RefreshData. The
+// last status is repeated once reached. Defaults to StatusDone.
+func (d *Device) SetRefreshStatuses(statuses ...int) *Device {
+	d.fake.mu.Lock()
+	defer d.fake.mu.Unlock()
+
+	d.refreshStatuses = statuses
+	return d
+}
+
+// SetWriteStatuses sets the sequence of statuses returned by the
+// successive RequestWriteStatus calls following a WriteData or a
+// WriteTimesheetData. The last status is repeated once
+// reached. Defaults to StatusDone.
+//
+// Writes are applied to d as soon as requested, unless the last
+// status is neither StatusDone nor StatusDoneDateTime.
+func (d *Device) SetWriteStatuses(statuses ...int) *Device {
+	d.fake.mu.Lock()
+	defer d.fake.mu.Unlock()
+
+	d.writeStatuses = statuses
+	return d
+}
+
+// SetIgnoreWrites sets whether d silently ignores the written
+// values of datapoints, while reporting successful writes, as
+// boilers sometimes do.
+func (d *Device) SetIgnoreWrites(ignore bool) *Device {
+	d.fake.mu.Lock()
+	defer d.fake.mu.Unlock()
+
+	d.ignoreWrites = ignore
+	return d
+}
+
+// SetOperationDuration sets the duration during which the
+// asynchronous operations started on d stay StatusPending, before
+// following the sequences of SetRefreshStatuses and
+// SetWriteStatuses.
+func (d *Device) SetOperationDuration(duration time.Duration) *Device {
+	d.fake.mu.Lock()
+	defer d.fake.mu.Unlock()
+
+	d.opDuration = duration
+	return d
+}
+
+// hasError returns true if d has an active error. f.mu must be held.
+func (d *Device) hasError() bool {
+	for _, event := range d.errors {
+		if event.IsActive {
+			return true
+		}
+	}
+	return false
+}
+
+// operationTTL is the duration after which an operation whose final
+// status has never been requested is forgotten.
+const operationTTL = time.Hour
+
+// operation is an asynchronous operation started by RefreshData,
+// WriteData or WriteTimesheetData. It is forgotten once its final
+// status has been returned, or after operationTTL.
+type operation struct {
+	write    bool
+	statuses []int
+	polls    int
+	started  time.Time
+	end      time.Time // StatusPending before
+}
+
+func (o *operation) nextStatus(now time.Time) int {
+	if now.Before(o.end) {
+		return StatusPending
+	}
+	if len(o.statuses) == 0 {
+		return StatusDone
+	}
+	idx := o.polls
+	if idx >= len(o.statuses) {
+		idx = len(o.statuses) - 1
+	}
+	o.polls++
+	return o.statuses[idx]
+}
+
+func succeeds(statuses []int) bool {
+	if len(statuses) == 0 {
+		return true
+	}
+	last := statuses[len(statuses)-1]
+	return last == StatusDone || last == StatusDoneDateTime
+}
@@ -0,0 +1,379 @@
+package vitotroltest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	td "github.com/maxatome/go-testdeep"
+
+	"github.com/maxatome/go-vitotrol"
+	"github.com/maxatome/go-vitotrol/vitotroltest"
+)
+
+func wait(t *td.T, ch <-chan error, err error) error {
+	t.Helper()
+	if !t.CmpNoError(err) {
+		return err
+	}
+	select {
+	case err = <-ch:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("TIMEOUT!")
+		return nil
+	}
+}
+
+func TestFake(tt *testing.T) {
+	t := td.NewT(tt)
+
+	fake := vitotroltest.New()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	fake.Now = func() time.Time { return now }
+
+	location := fake.AddAccount("pipo", "bingo").
+		SetName("Maxime", "Soulé").
+		AddLocation(12, "Home")
+	dev := location.AddDevice(34, "Boiler").
+		SetValue(vitotrol.IndoorTemp, "21.5").
+		SetValue(vitotrol.BurnerState, "0").
+		SetTimesheet(7193, map[string]vitotrol.TimeslotSlice{
+			"mon": {{From: 1800, To: 2200}, {From: 600, To: 800}},
+		}).
+		AddError(vitotrol.ErrorHistoryEvent{
+			Error:    "F4",
+			Message:  "Flame signal missing",
+			Time:     vitotrol.Time(now),
+			IsActive: true,
+		}).
+		SetTypeInfo([]*vitotrol.AttributeInfo{
+			{
+				AttributeInfoBase: vitotrol.AttributeInfoBase{
+					AttributeName: "temp_rts_r",
+					AttributeType: "DOUBLE",
+					Readable:      true,
+				},
+				AttributeID: vitotrol.IndoorTemp,
+			},
+			{
+				AttributeInfoBase: vitotrol.AttributeInfoBase{
+					AttributeName: "zustand_brenner_r",
+					AttributeType: "ENUM",
+					Readable:      true,
+				},
+				AttributeID: vitotrol.BurnerState,
+				EnumValues:  map[uint32]string{0: "off", 1: "on"},
+			},
+		})
+	location.AddDevice(56, "Heat pump").SetOffline(true)
+
+	srv := vitotroltest.NewServer(fake)
+	defer srv.Close()
+
+	v := vitotrol.NewSession(vitotrol.WithEndpoint(srv.URL),
+		vitotrol.WithDefaultWait(vitotrol.WaitConfig{First: -1, Min: -1}),
+		vitotroltest.WithResultErrors())
+
+	// Not logged in
+	err := v.GetDevices()
+	t.CmpErrorIs(err, vitotrol.ErrSessionExpired)
+
+	// Bad credentials
+	err = v.Login("pipo", "bad")
+	t.CmpErrorIs(err, vitotrol.ErrInvalidCredentials)
+
+	if !t.CmpNoError(v.Login("pipo", "bingo")) {
+		return
+	}
+
+	// GetDevices
+	if !t.CmpNoError(v.GetDevices()) {
+		return
+	}
+	devices := v.DevicesList()
+	t.Cmp(devices, td.All(
+		td.Len(2),
+		td.ArrayEach(td.Struct(&vitotrol.Device{LocationID: 12, LocationName: "Home"}, nil)),
+	))
+	t.Cmp(devices[0], td.Struct(&vitotrol.Device{
+		DeviceID:    34,
+		DeviceName:  "Boiler",
+		HasError:    true,
+		IsConnected: true,
+	}, nil))
+	t.Cmp(devices[1], td.Struct(&vitotrol.Device{
+		DeviceID:    56,
+		DeviceName:  "Heat pump",
+		IsConnected: false,
+	}, nil))
+	d := devices[0]
+
+	// GetData
+	if t.CmpNoError(d.GetData(v, []vitotrol.AttrID{vitotrol.IndoorTemp})) {
+		value, ok := d.Attribute(vitotrol.IndoorTemp)
+		t.True(ok)
+		t.Cmp(value.Value, "21.5")
+		t.Cmp(time.Time(value.Time), now)
+	}
+	err = d.GetData(v, []vitotrol.AttrID{9999})
+	t.CmpErrorIs(err, vitotrol.ErrUnknownDatapoint)
+
+	// Offline device
+	err = devices[1].GetData(v, []vitotrol.AttrID{vitotrol.IndoorTemp})
+	t.CmpErrorIs(err, vitotrol.ErrDeviceOffline)
+
+	// WriteDataWait with a slow status sequence
+	dev.SetWriteStatuses(vitotroltest.StatusPending, vitotroltest.StatusPending,
+		vitotroltest.StatusDone)
+	ch, err := d.WriteDataWait(v, vitotrol.IndoorTemp, "19")
+	t.CmpNoError(wait(t, ch, err))
+	value, _ := dev.Value(vitotrol.IndoorTemp)
+	t.Cmp(value, "19")
+
+	// Failed write
+	dev.SetWriteStatuses(vitotroltest.StatusPending, 5)
+	ch, err = d.WriteDataWait(v, vitotrol.IndoorTemp, "25")
+	t.CmpError(wait(t, ch, err))
+	value, _ = dev.Value(vitotrol.IndoorTemp)
+	t.Cmp(value, "19")
+
+	// RefreshDataWait
+	now = now.Add(time.Hour)
+	ch, err = d.RefreshDataWait(v, []vitotrol.AttrID{vitotrol.IndoorTemp})
+	if t.CmpNoError(wait(t, ch, err)) &&
+		t.CmpNoError(d.GetData(v, []vitotrol.AttrID{vitotrol.IndoorTemp})) {
+		value, ok := d.Attribute(vitotrol.IndoorTemp)
+		t.True(ok)
+		t.Cmp(value.Value, "19")
+		t.Cmp(time.Time(value.Time), now)
+	}
+
+	// Unknown refresh ID
+	_, err = v.RequestRefreshStatus("666")
+	t.CmpErrorIs(err, vitotrol.ErrUnknownDatapoint)
+
+	// Timesheets
+	if t.CmpNoError(d.GetTimesheetData(v, 7193)) {
+		timesheet, _ := d.Timesheet(7193)
+		t.Cmp(timesheet, map[string]vitotrol.TimeslotSlice{
+			"mon": {{From: 600, To: 800}, {From: 1800, To: 2200}},
+		})
+	}
+	err = d.GetTimesheetData(v, 1234)
+	t.CmpErrorIs(err, vitotrol.ErrUnknownDatapoint)
+
+	dev.SetWriteStatuses(vitotroltest.StatusDone)
+	ch, err = d.WriteTimesheetDataWait(v, 7193, map[string]vitotrol.TimeslotSlice{
+		"mon-tue": {{From: 700, To: 2100}},
+	})
+	if t.CmpNoError(wait(t, ch, err)) &&
+		t.CmpNoError(d.GetTimesheetData(v, 7193)) {
+		timesheet, _ := d.Timesheet(7193)
+		t.Cmp(timesheet, map[string]vitotrol.TimeslotSlice{
+			"mon": {{From: 700, To: 2100}},
+			"tue": {{From: 700, To: 2100}},
+		})
+		timesheet, ok := dev.Timesheet(7193)
+		t.True(ok)
+		t.Cmp(timesheet, map[string]vitotrol.TimeslotSlice{
+			"mon": {{From: 700, To: 2100}},
+			"tue": {{From: 700, To: 2100}},
+		})
+	}
+
+	// GetErrorHistory
+	if t.CmpNoError(d.GetErrorHistory(v)) {
+		t.Cmp(d.ErrorsSnapshot(), []vitotrol.ErrorHistoryEvent{{
+			Error:    "F4",
+			Message:  "Flame signal missing",
+			Time:     vitotrol.Time(time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)),
+			IsActive: true,
+		}})
+	}
+
+	// GetTypeInfo
+	infos, err := d.GetTypeInfo(v)
+	if t.CmpNoError(err) {
+		t.Cmp(infos, []*vitotrol.AttributeInfo{
+			{
+				AttributeInfoBase: vitotrol.AttributeInfoBase{
+					AttributeName: "temp_rts_r",
+					AttributeType: "DOUBLE",
+					Readable:      true,
+				},
+				AttributeID: vitotrol.IndoorTemp,
+			},
+			{
+				AttributeInfoBase: vitotrol.AttributeInfoBase{
+					AttributeName: "zustand_brenner_r",
+					AttributeType: "ENUM",
+					Readable:      true,
+				},
+				AttributeID: vitotrol.BurnerState,
+				EnumValues:  map[uint32]string{0: "off", 1: "on"},
+			},
+		})
+	}
+}
+
+func TestFakeSessionExpired(tt *testing.T) {
+	t := td.NewT(tt)
+
+	fake := vitotroltest.New()
+	fake.AddAccount("pipo", "bingo")
+
+	srv := vitotroltest.NewServer(fake)
+	defer srv.Close()
+
+	relogins := 0
+	v := vitotrol.NewSession(
+		vitotrol.WithEndpoint(srv.URL),
+		vitotrol.WithCredentials(vitotrol.StaticCredentials("pipo", "bingo")),
+		vitotrol.WithSessionExpiry(
+			vitotrol.MatchResult(vitotroltest.ResultSessionExpired)),
+		vitotrol.WithReloginHook(func(err error) {
+			t.CmpNoError(err)
+			relogins++
+		}),
+	)
+	t.CmpNoError(v.LoginWithCredentials(context.Background()))
+	t.CmpNoError(v.GetDevices())
+
+	fake.ExpireSessions()
+	t.CmpNoError(v.GetDevices())
+	t.Cmp(relogins, 1)
+}
+
+func TestFakeUnknownAction(tt *testing.T) {
+	t := td.NewT(tt)
+
+	srv := vitotroltest.NewServer(vitotroltest.New())
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(""))
+	if !t.CmpNoError(err) {
+		return
+	}
+	req.Header.Set("SOAPAction", "http://www.e-controlnet.de/services/vii/Unknown")
+
+	resp, err := http.DefaultClient.Do(req)
+	if !t.CmpNoError(err) {
+		return
+	}
+	defer resp.Body.Close()
+	t.Cmp(resp.StatusCode, http.StatusInternalServerError)
+
+	// As seen by a Session
+	v := vitotrol.NewSession(vitotrol.WithEndpoint(srv.URL),
+		vitotrol.WithSOAPNamespace("http://other/"))
+	err = v.Login("pipo", "bingo")
+	var fault *vitotrol.SOAPFault
+	if t.True(errors.As(err, &fault)) {
+		t.Cmp(fault.Code, "soap:Client")
+	}
+}
+
+func TestFakeFaults(tt *testing.T) {
+	t := td.NewT(tt)
+
+	fake := vitotroltest.New()
+	fake.AddAccount("pipo", "bingo")
+
+	srv := vitotroltest.NewServer(fake)
+	defer srv.Close()
+
+	v := vitotrol.NewSession(vitotrol.WithEndpoint(srv.URL),
+		vitotroltest.WithResultErrors())
+	t.CmpNoError(v.Login("pipo", "bingo"))
+
+	// Result code, only once
+	fake.InjectFault(vitotroltest.Fault{
+		Action:     "GetDevices",
+		Result:     vitotroltest.ResultServerBusy,
+		ResultText: "Busy",
+		Count:      1,
+	})
+	t.CmpErrorIs(v.GetDevices(), vitotrol.ErrServerBusy)
+	t.CmpNoError(v.GetDevices())
+
+	// HTTP status, for all actions
+	fake.InjectFault(vitotroltest.Fault{HTTPStatus: http.StatusServiceUnavailable})
+	t.CmpErrorIs(v.GetDevices(), vitotrol.ErrServerBusy)
+	t.CmpErrorIs(v.Login("pipo", "bingo"), vitotrol.ErrServerBusy)
+	fake.ClearFaults()
+	t.CmpNoError(v.GetDevices())
+
+	// Expired session, Login credentials are reused to re-login
+	relogins := 0
+	v.OnRelogin = func(error) { relogins++ }
+	fake.InjectFault(vitotroltest.Fault{ExpireSessions: true, Count: 1})
+	t.CmpNoError(v.GetDevices())
+	t.Cmp(relogins, 1)
+
+	// Delay
+	fake.InjectFault(vitotroltest.Fault{Delay: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	t.CmpErrorIs(v.GetDevicesContext(ctx), context.DeadlineExceeded)
+}
+
+func TestFakeOperationDuration(tt *testing.T) {
+	t := td.NewT(tt)
+
+	fake := vitotroltest.New()
+	now := time.Now()
+	fake.Now = func() time.Time { return now }
+
+	dev := fake.AddAccount("pipo", "bingo").
+		AddLocation(12, "Home").
+		AddDevice(34, "Boiler")
+	v, d := vitotroltest.NewSessionWithDevice(t, fake, "pipo", "bingo", dev,
+		vitotroltest.WithResultErrors())
+	dev.SetValue(vitotrol.IndoorTemp, "21.5").
+		SetOperationDuration(time.Minute).
+		SetRefreshStatuses(3, vitotroltest.StatusDone)
+
+	refreshID, err := d.RefreshData(v, []vitotrol.AttrID{vitotrol.IndoorTemp})
+	if !t.CmpNoError(err) {
+		return
+	}
+
+	status, err := v.RequestRefreshStatus(refreshID)
+	t.CmpNoError(err)
+	t.Cmp(status, vitotrol.RefreshPending)
+
+	now = now.Add(time.Minute)
+	status, err = v.RequestRefreshStatus(refreshID)
+	t.CmpNoError(err)
+	t.Cmp(status, vitotrol.RefreshInProgress)
+
+	status, err = v.RequestRefreshStatus(refreshID)
+	t.CmpNoError(err)
+	t.Cmp(status, vitotrol.RefreshDone)
+
+	// Forgotten once its final status has been returned
+	_, err = v.RequestRefreshStatus(refreshID)
+	t.CmpErrorIs(err, vitotrol.ErrUnknownDatapoint)
+
+	// Write status of a refresh ID
+	refreshID, err = d.RefreshData(v, []vitotrol.AttrID{vitotrol.IndoorTemp})
+	if !t.CmpNoError(err) {
+		return
+	}
+	_, err = v.RequestWriteStatus(refreshID)
+	t.CmpErrorIs(err, vitotrol.ErrUnknownDatapoint)
+
+	// Abandoned operations are forgotten after one hour
+	status, err = v.RequestRefreshStatus(refreshID)
+	t.CmpNoError(err)
+	t.Cmp(status, vitotrol.RefreshPending)
+	now = now.Add(time.Hour)
+	_, err = d.RefreshData(v, []vitotrol.AttrID{vitotrol.IndoorTemp})
+	t.CmpNoError(err)
+	_, err = v.RequestRefreshStatus(refreshID)
+	t.CmpErrorIs(err, vitotrol.ErrUnknownDatapoint)
+}
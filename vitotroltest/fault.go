@@ -0,0 +1,77 @@
+package vitotroltest
+
+import (
+	"context"
+	"time"
+)
+
+// Fault describes a failure injected in the responses of a Fake. See
+// Fake.InjectFault.
+type Fault struct {
+	// Action is the SOAP action concerned by the fault. Empty means
+	// all actions.
+	Action string
+	// Delay is the duration to wait before answering, to simulate a
+	// slow server or a timeout.
+	Delay time.Duration
+	// ExpireSessions invalidates all sessions before handling the
+	// request, see Fake.ExpireSessions.
+	ExpireSessions bool
+	// HTTPStatus, if not 0, is the HTTP status replied instead of
+	// handling the request.
+	HTTPStatus int
+	// Result, if not 0, is the result code replied instead of
+	// handling the request, along with ResultText.
+	Result     int
+	ResultText string
+	// Count is the number of requests the fault applies to. 0 means
+	// forever.
+	Count int
+}
+
+// InjectFault adds fault to f. When several faults match a request,
+// the first injected one applies.
+func (f *Fake) InjectFault(fault Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.faults = append(f.faults, &fault)
+}
+
+// ClearFaults removes all the faults injected in f.
+func (f *Fake) ClearFaults() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.faults = nil
+}
+
+// fault returns the fault to apply to action, if any. f.mu must be
+// held.
+func (f *Fake) fault(action string) *Fault {
+	for idx, fault := range f.faults {
+		if fault.Action != "" && fault.Action != action {
+			continue
+		}
+
+		if fault.Count > 0 {
+			fault.Count--
+			if fault.Count == 0 {
+				f.faults = append(f.faults[:idx:idx], f.faults[idx+1:]...)
+			}
+		}
+		return fault
+	}
+	return nil
+}
+
+// sleep pauses the current goroutine during d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,655 @@
+package vitotroltest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/maxatome/go-vitotrol"
+)
+
+// Envelope of the responses sent by the Vitotrol™ server, to be
+// placed around the XML of a response.
+const (
+	EnvelopeHeader = `<?xml version="1.0" encoding="utf-8"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema"><soap:Body>`
+	EnvelopeFooter = `</soap:Body></soap:Envelope>`
+)
+
+const (
+	namespace     = "http://www.e-controlnet.de/services/vii/"
+	sessionCookie = "ASP.NET_SessionId"
+	timeFormat    = "2006-01-02 15:04:05"
+)
+
+// call is a SOAP request received by a Fake.
+type call struct {
+	action  string
+	body    []byte
+	account *Account
+}
+
+// decode decodes the action element of the request body in v.
+func (c *call) decode(v interface{}) error {
+	dec := xml.NewDecoder(bytes.NewReader(c.body))
+	inBody := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			if inBody {
+				return dec.DecodeElement(v, &se)
+			}
+			inBody = se.Name.Local == "Body"
+		}
+	}
+}
+
+type handler func(f *Fake, c *call) (interface{}, error)
+
+var handlers = map[string]handler{
+	"Login":                (*Fake).login,
+	"GetDevices":           (*Fake).getDevices,
+	"GetData":              (*Fake).getData,
+	"WriteData":            (*Fake).writeData,
+	"RefreshData":          (*Fake).refreshData,
+	"RequestRefreshStatus": (*Fake).requestRefreshStatus,
+	"RequestWriteStatus":   (*Fake).requestWriteStatus,
+	"GetErrorHistory":      (*Fake).getErrorHistory,
+	"GetTimesheetData":     (*Fake).getTimesheetData,
+	"WriteTimesheetData":   (*Fake).writeTimesheetData,
+	"GetTypeInfo":          (*Fake).getTypeInfo,
+}
+
+func resultError(num int, str string) *vitotrol.ResultHeader {
+	return &vitotrol.ResultHeader{ErrorNum: num, ErrorStr: str}
+}
+
+// ServeHTTP implements http.Handler interface.
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	soapAction := r.Header.Get("SOAPAction")
+	action := strings.TrimPrefix(soapAction, namespace)
+
+	h := handlers[action]
+	if r.Method != http.MethodPost || h == nil || action == soapAction {
+		writeFault(w, "soap:Client",
+			fmt.Sprintf("Server did not recognize the value of HTTP Header SOAPAction: %s.", soapAction))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeFault(w, "soap:Client", err.Error())
+		return
+	}
+
+	c := &call{action: action, body: body}
+
+	f.mu.Lock()
+	fault := f.fault(action)
+	if fault != nil {
+		fault := *fault
+		f.mu.Unlock()
+
+		if fault.Delay > 0 {
+			sleep(r.Context(), fault.Delay)
+		}
+		if fault.ExpireSessions {
+			f.ExpireSessions()
+		}
+		if fault.HTTPStatus != 0 {
+			w.WriteHeader(fault.HTTPStatus)
+			return
+		}
+		if fault.Result != 0 {
+			writeResult(w, action, &struct{ vitotrol.ResultHeader }{
+				vitotrol.ResultHeader{
+					ErrorNum: fault.Result,
+					ErrorStr: fault.ResultText,
+				},
+			})
+			return
+		}
+
+		f.mu.Lock()
+	}
+
+	var result interface{}
+	if action != "Login" {
+		c.account = f.sessions[sessionID(r)]
+		if c.account == nil {
+			err = resultError(ResultSessionExpired, "Session expired")
+		}
+	}
+	if err == nil {
+		result, err = h(f, c)
+	}
+	f.mu.Unlock()
+
+	if err != nil {
+		var rh *vitotrol.ResultHeader
+		if !errors.As(err, &rh) {
+			writeFault(w, "soap:Client", err.Error())
+			return
+		}
+		result = &struct{ vitotrol.ResultHeader }{*rh}
+	}
+
+	if cookie, ok := result.(*loginResult); ok && cookie.cookie != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    cookie.cookie,
+			Path:     "/",
+			HttpOnly: true,
+		})
+	}
+
+	writeResult(w, action, result)
+}
+
+// sessionID returns the session ID sent in the cookies of r.
+func sessionID(r *http.Request) string {
+	// Session sends back Set-Cookie values as is
+	for _, cookie := range r.Header.Values("Cookie") {
+		for _, part := range strings.Split(cookie, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == sessionCookie {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+func writeResult(w http.ResponseWriter, action string, result interface{}) {
+	var buf bytes.Buffer
+	buf.WriteString(EnvelopeHeader)
+	fmt.Fprintf(&buf, `<%sResponse xmlns="%s">`, action, namespace)
+	err := xml.NewEncoder(&buf).EncodeElement(result,
+		xml.StartElement{Name: xml.Name{Local: action + "Result"}})
+	if err != nil {
+		writeFault(w, "soap:Server", err.Error())
+		return
+	}
+	fmt.Fprintf(&buf, `</%sResponse>`, action)
+	buf.WriteString(EnvelopeFooter)
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.Write(buf.Bytes()) //nolint: errcheck
+}
+
+func writeFault(w http.ResponseWriter, code, str string) {
+	var buf bytes.Buffer
+	buf.WriteString(EnvelopeHeader + "<soap:Fault><faultcode>")
+	xml.EscapeText(&buf, []byte(code)) //nolint: errcheck
+	buf.WriteString("</faultcode><faultstring>")
+	xml.EscapeText(&buf, []byte(str)) //nolint: errcheck
+	buf.WriteString("</faultstring></soap:Fault>" + EnvelopeFooter)
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(buf.Bytes()) //nolint: errcheck
+}
+
+// newID returns a new unique ID. f.mu must be held.
+func (f *Fake) newID() string {
+	f.lastID++
+	return strconv.FormatUint(f.lastID, 10)
+}
+
+type deviceRequest struct {
+	DeviceID   uint32 `xml:"GeraetId"`
+	LocationID uint32 `xml:"AnlageId"`
+}
+
+// device returns the device targeted by req in the account of
+// c. f.mu must be held.
+func (c *call) device(req deviceRequest) (*Device, error) {
+	for _, l := range c.account.locations {
+		if l.id != req.LocationID {
+			continue
+		}
+		for _, d := range l.devices {
+			if d.id == req.DeviceID {
+				if d.offline {
+					return nil, resultError(ResultDeviceOffline, "Device offline")
+				}
+				return d, nil
+			}
+		}
+	}
+	return nil, resultError(ResultDeviceOffline,
+		fmt.Sprintf("Unknown device %d/%d", req.LocationID, req.DeviceID))
+}
+
+//
+// Login
+//
+
+type loginResult struct {
+	vitotrol.ResultHeader
+	Version   string `xml:"TechVersion"`
+	Firstname string `xml:"Vorname"`
+	Lastname  string `xml:"Nachname"`
+
+	cookie string
+}
+
+func (f *Fake) login(c *call) (interface{}, error) {
+	var req struct {
+		Password string `xml:"Passwort"`
+		Login    string `xml:"Benutzer"`
+	}
+	err := c.decode(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	a := f.accounts[req.Login]
+	if a == nil || a.password != req.Password {
+		return nil, resultError(ResultInvalidCredentials, "Invalid credentials")
+	}
+
+	cookie := "session-" + f.newID()
+	f.sessions[cookie] = a
+
+	return &loginResult{
+		Version:   "2.5.6.0",
+		Firstname: a.firstname,
+		Lastname:  a.lastname,
+		cookie:    cookie,
+	}, nil
+}
+
+//
+// GetDevices
+//
+
+type getDevicesDevice struct {
+	ID          uint32 `xml:"GeraetId"`
+	Name        string `xml:"GeraetName"`
+	HasError    bool   `xml:"HatFehler"`
+	IsConnected bool   `xml:"IstVerbunden"`
+}
+
+type getDevicesLocation struct {
+	ID          uint32             `xml:"AnlageId"`
+	Name        string             `xml:"AnlageName"`
+	Devices     []getDevicesDevice `xml:"GeraeteListe>GeraetV2"`
+	HasError    bool               `xml:"HatFehler"`
+	IsConnected bool               `xml:"IstVerbunden"`
+}
+
+func (f *Fake) getDevices(c *call) (interface{}, error) {
+	result := &struct {
+		vitotrol.ResultHeader
+		Locations []getDevicesLocation `xml:"AnlageListe>AnlageV2"`
+	}{}
+
+	for _, l := range c.account.locations {
+		location := getDevicesLocation{
+			ID:          l.id,
+			Name:        l.name,
+			IsConnected: true,
+		}
+		for _, d := range l.devices {
+			location.Devices = append(location.Devices, getDevicesDevice{
+				ID:          d.id,
+				Name:        d.name,
+				HasError:    d.hasError(),
+				IsConnected: !d.offline,
+			})
+		}
+		result.Locations = append(result.Locations, location)
+	}
+	return result, nil
+}
+
+//
+// GetData
+//
+
+type getDataValue struct {
+	ID    vitotrol.AttrID `xml:"DatenpunktId"`
+	Value string          `xml:"Wert"`
+	Time  string          `xml:"Zeitstempel"`
+}
+
+func (f *Fake) getData(c *call) (interface{}, error) {
+	var req struct {
+		deviceRequest
+		IDs []vitotrol.AttrID `xml:"DatenpunktIds>int"`
+	}
+	err := c.decode(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := c.device(req.deviceRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &struct {
+		vitotrol.ResultHeader
+		Values []getDataValue `xml:"DatenwerteListe>WerteListe"`
+	}{}
+	for _, id := range req.IDs {
+		dp, ok := d.values[id]
+		if !ok {
+			return nil, resultError(ResultUnknownDatapoint,
+				fmt.Sprintf("Unknown datapoint %d", id))
+		}
+		result.Values = append(result.Values, getDataValue{
+			ID:    id,
+			Value: dp.value,
+			Time:  dp.time.Format(timeFormat),
+		})
+	}
+	return result, nil
+}
+
+//
+// WriteData, RefreshData & WriteTimesheetData
+//
+
+type refreshIDResult struct {
+	vitotrol.ResultHeader
+	RefreshID string `xml:"AktualisierungsId"`
+}
+
+// startOperation registers a new asynchronous operation on d and
+// returns its refresh ID. f.mu must be held.
+func (f *Fake) startOperation(d *Device, write bool) *refreshIDResult {
+	statuses := d.refreshStatuses
+	if write {
+		statuses = d.writeStatuses
+	}
+
+	now := f.now()
+	for id, op := range f.ops {
+		if now.Sub(op.started) >= operationTTL {
+			delete(f.ops, id)
+		}
+	}
+
+	id := f.newID()
+	f.ops[id] = &operation{
+		write:    write,
+		statuses: append([]int(nil), statuses...),
+		started:  now,
+		end:      now.Add(d.opDuration),
+	}
+	return &refreshIDResult{RefreshID: id}
+}
+
+func (f *Fake) writeData(c *call) (interface{}, error) {
+	var req struct {
+		deviceRequest
+		ID    vitotrol.AttrID `xml:"DatapointId"`
+		Value string          `xml:"Wert"`
+	}
+	err := c.decode(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := c.device(req.deviceRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if succeeds(d.writeStatuses) && !d.ignoreWrites {
+		d.values[req.ID] = datapoint{value: req.Value, time: f.now()}
+	}
+	return f.startOperation(d, true), nil
+}
+
+func (f *Fake) refreshData(c *call) (interface{}, error) {
+	var req struct {
+		deviceRequest
+		IDs []vitotrol.AttrID `xml:"DatenpunktIds>int"`
+	}
+	err := c.decode(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := c.device(req.deviceRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if succeeds(d.refreshStatuses) {
+		now := f.now()
+		for _, id := range req.IDs {
+			if dp, ok := d.values[id]; ok {
+				dp.time = now
+				d.values[id] = dp
+			}
+		}
+	}
+	return f.startOperation(d, false), nil
+}
+
+func (f *Fake) writeTimesheetData(c *call) (interface{}, error) {
+	var req struct {
+		Data struct {
+			deviceRequest
+			ID    vitotrol.TimesheetID `xml:"DatenpunktId"`
+			Slots []struct {
+				Day  string `xml:"Wochentag"`
+				From uint16 `xml:"ZeitVon"`
+				To   uint16 `xml:"ZeitBis"`
+			} `xml:"Schaltzeiten>Schaltzeit"`
+		} `xml:"SchaltsatzData"`
+	}
+	err := c.decode(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := c.device(req.Data.deviceRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if succeeds(d.writeStatuses) {
+		timesheet := map[string]vitotrol.TimeslotSlice{}
+		for _, slot := range req.Data.Slots {
+			day := strings.ToLower(slot.Day)
+			timesheet[day] = append(timesheet[day], vitotrol.Timeslot{
+				From: slot.From,
+				To:   slot.To,
+			})
+		}
+		d.timesheets[req.Data.ID] = copyTimesheet(timesheet)
+	}
+	return f.startOperation(d, true), nil
+}
+
+//
+// RequestRefreshStatus & RequestWriteStatus
+//
+
+type statusResult struct {
+	vitotrol.ResultHeader
+	Status int `xml:"Status"`
+}
+
+func (f *Fake) requestStatus(c *call, write bool) (interface{}, error) {
+	var req struct {
+		RefreshID string `xml:"AktualisierungsId"`
+	}
+	err := c.decode(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	op := f.ops[req.RefreshID]
+	if op == nil || op.write != write {
+		return nil, resultError(ResultUnknownDatapoint,
+			fmt.Sprintf("Unknown refresh ID %s", req.RefreshID))
+	}
+	status := op.nextStatus(f.now())
+	if status != StatusPending && status != StatusInProgress {
+		delete(f.ops, req.RefreshID)
+	}
+	return &statusResult{Status: status}, nil
+}
+
+func (f *Fake) requestRefreshStatus(c *call) (interface{}, error) {
+	return f.requestStatus(c, false)
+}
+
+func (f *Fake) requestWriteStatus(c *call) (interface{}, error) {
+	return f.requestStatus(c, true)
+}
+
+//
+// GetErrorHistory
+//
+
+type errorHistoryEvent struct {
+	Error    string `xml:"FehlerCode"`
+	Message  string `xml:"FehlerMeldung"`
+	Time     string `xml:"Zeitstempel"`
+	IsActive bool   `xml:"FehlerIstAktiv"`
+}
+
+func (f *Fake) getErrorHistory(c *call) (interface{}, error) {
+	var req deviceRequest
+	err := c.decode(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := c.device(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &struct {
+		vitotrol.ResultHeader
+		Events []errorHistoryEvent `xml:"FehlerListe>FehlerHistorie"`
+	}{}
+	for _, event := range d.errors {
+		result.Events = append(result.Events, errorHistoryEvent{
+			Error:    event.Error,
+			Message:  event.Message,
+			Time:     event.Time.String(),
+			IsActive: event.IsActive,
+		})
+	}
+	return result, nil
+}
+
+//
+// GetTimesheetData
+//
+
+type daySlot struct {
+	Day  string `xml:"Wochentag"`
+	From uint16 `xml:"ZeitVon"`
+	To   uint16 `xml:"ZeitBis"`
+}
+
+var days = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+func (f *Fake) getTimesheetData(c *call) (interface{}, error) {
+	var req struct {
+		deviceRequest
+		ID vitotrol.TimesheetID `xml:"DatenpunktId"`
+	}
+	err := c.decode(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := c.device(req.deviceRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	timesheet, ok := d.timesheets[req.ID]
+	if !ok {
+		return nil, resultError(ResultUnknownDatapoint,
+			fmt.Sprintf("Unknown timesheet %d", req.ID))
+	}
+
+	result := &struct {
+		vitotrol.ResultHeader
+		ID       vitotrol.TimesheetID `xml:"SchaltsatzDaten>DatenpunktID"`
+		DaySlots []daySlot            `xml:"SchaltsatzDaten>Schaltzeiten>Schaltzeit"`
+	}{ID: req.ID}
+	for _, day := range days {
+		for _, slot := range timesheet[day] {
+			result.DaySlots = append(result.DaySlots, daySlot{
+				Day:  strings.ToUpper(day),
+				From: slot.From,
+				To:   slot.To,
+			})
+		}
+	}
+	return result, nil
+}
+
+//
+// GetTypeInfo
+//
+
+type attributeInfo struct {
+	AttributeID string `xml:"DatenpunktId"`
+	vitotrol.AttributeInfoBase
+}
+
+func (f *Fake) getTypeInfo(c *call) (interface{}, error) {
+	var req deviceRequest
+	err := c.decode(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := c.device(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &struct {
+		vitotrol.ResultHeader
+		Attributes []attributeInfo `xml:"TypeInfoListe>DatenpunktTypInfo"`
+	}{}
+	for _, info := range d.typeInfo {
+		id := strconv.FormatUint(uint64(info.AttributeID), 10)
+		result.Attributes = append(result.Attributes, attributeInfo{
+			AttributeID:       id,
+			AttributeInfoBase: info.AttributeInfoBase,
+		})
+
+		// Enum values come after their base attribute, the value
+		// being located in MinValue
+		idxs := make([]uint32, 0, len(info.EnumValues))
+		for idx := range info.EnumValues {
+			idxs = append(idxs, idx)
+		}
+		sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+		for _, idx := range idxs {
+			result.Attributes = append(result.Attributes, attributeInfo{
+				AttributeID: fmt.Sprintf("%s-%d", id, idx),
+				AttributeInfoBase: vitotrol.AttributeInfoBase{
+					AttributeName: info.AttributeName,
+					AttributeType: info.AttributeType,
+					MinValue:      info.EnumValues[idx],
+				},
+			})
+		}
+	}
+	return result, nil
+}
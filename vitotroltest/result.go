@@ -0,0 +1,35 @@
+package vitotroltest
+
+import (
+	"github.com/maxatome/go-vitotrol"
+)
+
+// Result codes returned by a Fake in the Ergebnis field of failed
+// responses. As the codes of the Vitotrol™ server are not documented,
+// these ones are specific to the Fake. See WithResultErrors to match
+// them using errors.Is.
+const (
+	ResultInvalidCredentials = 2
+	ResultSessionExpired     = 7
+	ResultUnknownDatapoint   = 9
+	ResultDeviceOffline      = 15
+	ResultServerBusy         = 99
+)
+
+// ResultErrors maps the result codes of a Fake to the errors of the
+// vitotrol package.
+var ResultErrors = map[int]error{
+	ResultInvalidCredentials: vitotrol.ErrInvalidCredentials,
+	ResultSessionExpired:     vitotrol.ErrSessionExpired,
+	ResultUnknownDatapoint:   vitotrol.ErrUnknownDatapoint,
+	ResultDeviceOffline:      vitotrol.ErrDeviceOffline,
+	ResultServerBusy:         vitotrol.ErrServerBusy,
+}
+
+// WithResultErrors returns the option making a session map the
+// result codes of a Fake to the errors of the vitotrol package, so
+// they trigger its automatic re-login and retries as errors of the
+// real server would. See vitotrol.WithResultErrors.
+func WithResultErrors() vitotrol.Option {
+	return vitotrol.WithResultErrors(ResultErrors)
+}
@@ -0,0 +1,41 @@
+package vitotroltest
+
+import (
+	"testing"
+
+	"github.com/maxatome/go-vitotrol"
+)
+
+// NewSessionWithDevice serves f until the end of the test tb, then
+// returns a session created using options and logged in using login
+// and password, along with the device of the session matching dev,
+// as listed by GetDevices. The account login owning dev has to be
+// added to f beforehand:
+//
+//	dev := fake.AddAccount("login", "password").
+//		AddLocation(1, "Home").
+//		AddDevice(2, "Boiler")
+//	v, d := vitotroltest.NewSessionWithDevice(t, fake, "login", "password", dev)
+func NewSessionWithDevice(tb testing.TB, f *Fake, login, password string, dev *Device, options ...vitotrol.Option) (*vitotrol.Session, *vitotrol.Device) {
+	tb.Helper()
+
+	srv := NewServer(f)
+	tb.Cleanup(srv.Close)
+
+	options = append([]vitotrol.Option{vitotrol.WithEndpoint(srv.URL)}, options...)
+	v := vitotrol.NewSession(options...)
+	if err := v.Login(login, password); err != nil {
+		tb.Fatalf("Login failed: %s", err)
+	}
+	if err := v.GetDevices(); err != nil {
+		tb.Fatalf("GetDevices failed: %s", err)
+	}
+
+	for _, d := range v.DevicesList() {
+		if d.LocationID == dev.location.id && d.DeviceID == dev.id {
+			return v, d
+		}
+	}
+	tb.Fatalf("Device %d of location %d not found", dev.id, dev.location.id)
+	return nil, nil
+}
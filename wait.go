@@ -0,0 +1,95 @@
+package vitotrol
+
+import (
+	"time"
+)
+
+// WaitConfig configures the polling of the status of an asynchronous
+// Operation. Zero fields take the default values, see
+// WithDefaultWait and WithWait.
+type WaitConfig struct {
+	// First is the duration to wait after the request starting the
+	// operation before requesting its status for the first time.
+	First time.Duration
+	// Min is the minimal duration of pauses between status requests.
+	Min time.Duration
+	// Timeout is the max amount of time to wait before failing with
+	// ErrTimeout. A negative Timeout means no timeout.
+	Timeout time.Duration
+	// Factor divides each pause to compute the next one, until Min
+	// is reached. Defaults to 4. A Factor of 1 keeps polling every
+	// First, other values lower than 1 are treated as 1.
+	Factor float64
+}
+
+// DefaultWaitFactor is the default WaitConfig.Factor.
+const DefaultWaitFactor = 4
+
+// withDefaults returns c whose zero fields are replaced by the ones
+// of def.
+func (c WaitConfig) withDefaults(def WaitConfig) WaitConfig {
+	if c.First == 0 {
+		c.First = def.First
+	}
+	if c.Min == 0 {
+		c.Min = def.Min
+	}
+	if c.Timeout == 0 {
+		c.Timeout = def.Timeout
+	}
+	if c.Factor == 0 {
+		c.Factor = def.Factor
+	}
+	return c
+}
+
+// next returns the pause following wait.
+func (c WaitConfig) next(wait time.Duration) time.Duration {
+	factor := c.Factor
+	switch {
+	case factor == 0:
+		factor = DefaultWaitFactor
+	case factor < 1:
+		factor = 1
+	}
+	wait = time.Duration(float64(wait) / factor)
+	if wait < c.Min {
+		wait = c.Min
+	}
+	return wait
+}
+
+// timedOut returns true if an operation lasting for elapsed lasts for
+// too long.
+func (c WaitConfig) timedOut(elapsed time.Duration) bool {
+	return c.Timeout >= 0 && elapsed >= c.Timeout
+}
+
+// waitConfig returns the configuration to use for op, def containing
+// the package defaults for this kind of operation.
+func (v *Session) waitConfig(op *Operation, def WaitConfig) WaitConfig {
+	def.Factor = DefaultWaitFactor
+	if v.Wait != nil {
+		def = v.Wait.withDefaults(def)
+	}
+	if op.wait != nil {
+		def = op.wait.withDefaults(def)
+	}
+	return def
+}
+
+// WithWait sets the polling configuration of the operation,
+// overriding the session one. See Session.Wait.
+func WithWait(config WaitConfig) OperationOption {
+	return func(o *Operation) {
+		o.wait = &config
+	}
+}
+
+// WithDefaultWait sets the polling configuration of all the
+// operations of the session. See Session.Wait.
+func WithDefaultWait(config WaitConfig) Option {
+	return func(v *Session) {
+		v.Wait = &config
+	}
+}
@@ -0,0 +1,95 @@
+package vitotrol
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	td "github.com/maxatome/go-testdeep"
+)
+
+func TestWaitConfig(tt *testing.T) {
+	t := td.NewT(tt)
+
+	def := WaitConfig{First: 8 * time.Second, Min: time.Second, Timeout: time.Minute}
+
+	// Defaults
+	v := NewSession()
+	op := &Operation{}
+	t.Cmp(v.waitConfig(op, def), WaitConfig{
+		First:   8 * time.Second,
+		Min:     time.Second,
+		Timeout: time.Minute,
+		Factor:  DefaultWaitFactor,
+	})
+
+	// Session overrides defaults, operation overrides session
+	v = NewSession(WithDefaultWait(WaitConfig{Min: 2 * time.Second, Factor: 2}))
+	t.Cmp(v.waitConfig(op, def), WaitConfig{
+		First:   8 * time.Second,
+		Min:     2 * time.Second,
+		Timeout: time.Minute,
+		Factor:  2,
+	})
+
+	WithWait(WaitConfig{Timeout: -1})(op)
+	t.Cmp(v.waitConfig(op, def), WaitConfig{
+		First:   8 * time.Second,
+		Min:     2 * time.Second,
+		Timeout: -1,
+		Factor:  2,
+	})
+
+	// Pauses
+	c := WaitConfig{Min: time.Second, Factor: 2}
+	t.Cmp(c.next(8*time.Second), 4*time.Second)
+	t.Cmp(c.next(time.Second), time.Second)
+	c.Factor = 0
+	t.Cmp(c.next(8*time.Second), 2*time.Second)
+	// Fixed interval
+	c.Factor = 1
+	t.Cmp(c.next(8*time.Second), 8*time.Second)
+	c.Factor = 0.5
+	t.Cmp(c.next(8*time.Second), 8*time.Second)
+
+	// Timeout
+	c = WaitConfig{Timeout: time.Minute}
+	t.False(c.timedOut(time.Second))
+	t.True(c.timedOut(time.Minute))
+	c.Timeout = -1
+	t.False(c.timedOut(time.Hour))
+}
+
+func TestWaitTimeout(tt *testing.T) {
+	t := td.NewT(tt)
+
+	ts := newOperationServer(1) // always pending
+	defer ts.Close()
+
+	d := &Device{DeviceID: testDeviceID, LocationID: testLocationID}
+	config := WaitConfig{
+		First:   time.Millisecond,
+		Min:     time.Millisecond,
+		Timeout: 20 * time.Millisecond,
+	}
+
+	// Per operation
+	v := NewSession(WithEndpoint(ts.URL))
+	op, err := d.StartRefreshData(context.Background(), v, refreshDataTestIDs,
+		WithWait(config))
+	if t.CmpNoError(err) {
+		t.CmpErrorIs(op.Wait(context.Background()), ErrTimeout)
+	}
+
+	// Per session, the *WaitTimeout global variables are ignored
+	v = NewSession(WithEndpoint(ts.URL), WithDefaultWait(config))
+	ch, err := d.WriteDataWait(v, writeDataTestID, writeDataTestValue)
+	if t.CmpNoError(err) {
+		select {
+		case err = <-ch:
+			t.CmpErrorIs(err, ErrTimeout)
+		case <-time.After(time.Second):
+			t.Error("TIMEOUT!")
+		}
+	}
+}